@@ -5,11 +5,15 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"io"
 	"os"
+	"path"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -217,7 +221,28 @@ func wrap_function(out io.Writer, fun *ast.FuncDecl) {
 	fmt.Fprintf(out, "\n")
 }
 
-func process_file(out io.Writer, filename string) {
+// adds import paths of the packages the types of the function refer to
+func collect_imports(imports map[string]bool, fun *ast.FuncDecl, file *ast.File) {
+	names := make(map[string]string)
+	for _, imp := range file.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := path.Base(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		names[name] = p
+	}
+	ast.Inspect(fun.Type, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && names[x.Name] != "" {
+				imports[names[x.Name]] = true
+			}
+		}
+		return true
+	})
+}
+
+func process_file(out io.Writer, imports map[string]bool, filename string) {
 	fset := token.NewFileSet()
 	file, err := parser.ParseFile(fset, filename, nil, 0)
 	if err != nil {
@@ -228,6 +253,7 @@ func process_file(out io.Writer, filename string) {
 		if fdecl, ok := decl.(*ast.FuncDecl); ok {
 			namelen := len(fdecl.Name.Name)
 			if namelen >= len(prefix) && fdecl.Name.Name[0:len(prefix)] == prefix {
+				collect_imports(imports, fdecl, file)
 				wrap_function(out, fdecl)
 			}
 		}
@@ -239,8 +265,7 @@ const head = `// WARNING! Autogenerated by goremote, don't touch.
 package main
 
 import (
-	"net/rpc"
-)
+%s)
 
 type RPC struct {
 }
@@ -249,8 +274,26 @@ type RPC struct {
 
 func main() {
 	flag.Parse()
-	fmt.Fprintf(os.Stdout, head)
+	imports := map[string]bool{"net/rpc": true}
+	body := bytes.NewBuffer(make([]byte, 0, 4096))
 	for _, file := range flag.Args() {
-		process_file(os.Stdout, file)
+		process_file(body, imports, file)
+	}
+
+	paths := make([]string, 0, len(imports))
+	for p := range imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	specs := ""
+	for _, p := range paths {
+		specs += "\t" + strconv.Quote(p) + "\n"
+	}
+
+	src := append([]byte(fmt.Sprintf(head, specs)), body.Bytes()...)
+	formatted, err := format.Source(src)
+	if err != nil {
+		panic(err)
 	}
+	os.Stdout.Write(formatted)
 }
@@ -21,26 +21,83 @@ EXPECTED = YELLOW + "EXPECTED: " + NC
 expected_to_fail = {
 }
 
+# A test may have several cursors, the expected output for the one at
+# "cursor.N" is in "out.expected.N" then. The optional "command" file holds
+# the gocode command to run instead of autocompletion, "$file" and "$cursor"
+# in it are substituted, "command.N" is the one for the cursor N only.
+def read_command(t, cursorpos):
+	for name in [t + "/command." + cursorpos, t + "/command"]:
+		if os.path.exists(name):
+			with open(name, "r") as f:
+				return f.read().split()
+	return ["autocomplete", "$file", "$cursor"]
+
+# The optional "config" file has gocode options to set for the test, a
+# "name value" per line, they are restored afterwards. The optional "env"
+# file has environment variables, a "NAME=value" per line, "$dir" in the
+# values is the absolute path of the test directory.
+def read_lines(name):
+	try:
+		with open(name, "r") as f:
+			return [l.strip() for l in f if l.strip()]
+	except:
+		return []
+
+def set_config(options):
+	old = []
+	with open(os.devnull, "w") as devnull:
+		for name, value in options:
+			out = subprocess.Popen(["gocode", "set", name], stdout=subprocess.PIPE).communicate()[0]
+			old.append((name, out.split(None, 1)[1].strip().strip('"')))
+			subprocess.call(["gocode", "set", name, value], stdout=devnull)
+	return old
+
+def read_env(t):
+	env = dict(os.environ)
+	for line in read_lines(t + "/env"):
+		name, value = line.split("=", 1)
+		env[name] = value.replace("$dir", os.path.abspath(t))
+	return env
+
 def run_test(t):
+	old = set_config([l.split(None, 1) for l in read_lines(t + "/config")])
+	try:
+		run_cursors(t)
+	finally:
+		set_config(old)
+
+def run_cursors(t):
+	cursors = sorted([os.path.splitext(c)[1][1:] for c in glob.glob(t + "/cursor.*")], key=int)
+	if not cursors:
+		cursors = [""]
+	for cursorpos in cursors:
+		expectedname = t + "/out.expected"
+		if len(cursors) > 1:
+			expectedname += "." + cursorpos
+		run_request(t, cursorpos, expectedname)
+
+def run_request(t, cursorpos, expectedname):
 	global total, ok, fail, expected_fail
 	total += 1
-	c = glob.glob(t + "/cursor.*")[0]
-	cursorpos = os.path.splitext(c)[1][1:]
+	name = t
+	if expectedname != t + "/out.expected":
+		name += " (cursor " + cursorpos + ")"
 	try:
-		with open(t + "/out.expected", "r") as f:
+		with open(expectedname, "r") as f:
 			outexpected = f.read()
 	except:
 		outexpected = "To be determined"
 	filename = t + "/test.go.in"
-	gocode = subprocess.Popen(["gocode", "-in", filename, "autocomplete", filename, cursorpos],
-			shell=False, stdout=subprocess.PIPE)
-	out = gocode.communicate()[0]
+	args = [a.replace("$file", filename).replace("$cursor", cursorpos) for a in read_command(t, cursorpos)]
+	gocode = subprocess.Popen(["gocode", "-in", filename] + args,
+			shell=False, env=read_env(t), stdout=subprocess.PIPE, stderr=subprocess.STDOUT)
+	out = gocode.communicate()[0].replace(os.path.abspath(t), "$dir")
 	if out != outexpected:
 		if t in expected_to_fail:
-			print t + ": " + FAIL + " " + EXPECTED + expected_to_fail[t]
+			print name + ": " + FAIL + " " + EXPECTED + expected_to_fail[t]
 			expected_fail += 1
 		else:
-			print t + ": " + FAIL
+			print name + ": " + FAIL
 			print "--------------------------------------------------------"
 			print "Got:\n" + out
 			print "--------------------------------------------------------"
@@ -48,7 +105,7 @@ def run_test(t):
 			print "--------------------------------------------------------"
 			fail += 1
 	else:
-		print t + ": " + OK
+		print name + ": " + OK
 		ok += 1
 
 if len(sys.argv) == 2:
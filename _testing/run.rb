@@ -31,20 +31,76 @@ def print_stats
 	puts "#{$stats.fail == 0 ? GRN : RED}#{"█"*72}#{NC}"
 end
 
+# A test may have several cursors, the expected output for the one at
+# "cursor.N" is in "out.expected.N" then. The optional "command" file holds
+# the gocode command to run instead of autocompletion, "$file" and "$cursor"
+# in it are substituted, "command.N" is the one for the cursor N only.
+def read_command(t, cursorpos)
+	["#{t}/command.#{cursorpos}", "#{t}/command"].each do |name|
+		return IO.read(name).split if File.file?(name)
+	end
+	["autocomplete", "$file", "$cursor"]
+end
+
+# The optional "config" file has gocode options to set for the test, a
+# "name value" per line, they are restored afterwards. The optional "env"
+# file has environment variables, a "NAME=value" per line, "$dir" in the
+# values is the absolute path of the test directory.
+def read_lines(name)
+	IO.readlines(name).map(&:strip).reject(&:empty?) rescue []
+end
+
+def set_config(options)
+	options.map do |name, value|
+		old = IO.popen(["gocode", "set", name]) {|io| io.read}.split(" ", 2)[1].strip.delete('"')
+		system("gocode", "set", name, value, :out => File::NULL)
+		[name, old]
+	end
+end
+
+def read_env(t)
+	read_lines("#{t}/env").map do |line|
+		name, value = line.split("=", 2)
+		[name, value.gsub("$dir", File.expand_path(t))]
+	end.to_h
+end
+
 def run_test(t)
+	old = set_config(read_lines("#{t}/config").map{|l| l.split(" ", 2)})
+	begin
+		run_cursors(t)
+	ensure
+		set_config(old)
+	end
+end
+
+def run_cursors(t)
+	cursors = Dir["#{t}/cursor.*"].map{|d| File.extname(d)[1..-1]}.sort_by(&:to_i)
+	cursors = [""] if cursors.empty?
+	cursors.each do |cursorpos|
+		expectedname = "#{t}/out.expected"
+		expectedname += ".#{cursorpos}" if cursors.length > 1
+		run_request(t, cursorpos, expectedname)
+	end
+end
+
+def run_request(t, cursorpos, expectedname)
 	$stats.total += 1
 
-	cursorpos = Dir["#{t}/cursor.*"].map{|d| File.extname(d)[1..-1]}.first
-	outexpected = IO.read("#{t}/out.expected") rescue "To be determined"
+	name = t
+	name += " (cursor #{cursorpos})" if expectedname != "#{t}/out.expected"
+	outexpected = IO.read(expectedname) rescue "To be determined"
 	filename = "#{t}/test.go.in"
+	args = read_command(t, cursorpos).map{|a| a.gsub("$file", filename).gsub("$cursor", cursorpos)}
 
-	out = %x[gocode -in #{filename} autocomplete #{filename} #{cursorpos}]
+	out = IO.popen([read_env(t), "gocode", "-in", filename, *args, :err => [:child, :out]]) {|io| io.read}
+	out = out.gsub(File.expand_path(t), "$dir")
 
 	if out != outexpected then
-		print_fail_report(t, out, outexpected)
+		print_fail_report(name, out, outexpected)
 		$stats.fail += 1
 	else
-		print_pass_report(t)
+		print_pass_report(name)
 		$stats.ok += 1
 	end
 end
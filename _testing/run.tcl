@@ -47,21 +47,129 @@ proc read_file {filename} {
 	return $data
 }
 
+# A test may have several cursors, the expected output for the one at
+# "cursor.N" is in "out.expected.N" then. The optional "command" file holds
+# the gocode command to run instead of autocompletion, "$file" and "$cursor"
+# in it are substituted, "command.N" is the one for the cursor N only.
+proc read_command {t cursorpos} {
+	foreach name [list "${t}/command.${cursorpos}" "${t}/command"] {
+		if {[file isfile $name]} {
+			return [regexp -all -inline {\S+} [read_file $name]]
+		}
+	}
+	return [list autocomplete {$file} {$cursor}]
+}
+
+# The optional "config" file has gocode options to set for the test, a
+# "name value" per line, they are restored afterwards. The optional "env"
+# file has environment variables, a "NAME=value" per line, "$dir" in the
+# values is the absolute path of the test directory.
+proc read_lines {filename} {
+	if {[catch {read_file $filename} data]} {
+		return {}
+	}
+	set lines {}
+	foreach line [split $data "\n"] {
+		set line [string trim $line]
+		if {$line ne ""} {
+			lappend lines $line
+		}
+	}
+	return $lines
+}
+
+proc set_config {options} {
+	set old {}
+	foreach {name value} $options {
+		set out [exec gocode set $name]
+		lappend old $name [string trim [lindex [split $out " "] 1] {"}]
+		exec gocode set $name $value
+	}
+	return $old
+}
+
+proc read_env {t} {
+	set env {}
+	foreach line [read_lines "${t}/env"] {
+		set i [string first "=" $line]
+		set value [string range $line [expr {$i+1}] end]
+		lappend env [string range $line 0 [expr {$i-1}]] \
+			[string map [list {$dir} [file normalize $t]] $value]
+	}
+	return $env
+}
+
 proc run_test {t} {
-	global stats.total stats.ok stats.fail
+	set options {}
+	foreach line [read_lines "${t}/config"] {
+		regexp {^(\S+)\s+(.*)$} $line -> name value
+		lappend options $name $value
+	}
+	set old [set_config $options]
+	try {
+		run_cursors $t
+	} finally {
+		set_config $old
+	}
+}
+
+proc run_cursors {t} {
+	set cursors {}
+	foreach c [glob -nocomplain "${t}/cursor.*"] {
+		lappend cursors [string range [file extension $c] 1 end]
+	}
+	set cursors [lsort -integer $cursors]
+	if {[llength $cursors] == 0} {
+		set cursors [list ""]
+	}
+	foreach cursorpos $cursors {
+		set expectedname "${t}/out.expected"
+		if {[llength $cursors] > 1} {
+			append expectedname ".${cursorpos}"
+		}
+		run_request $t $cursorpos $expectedname
+	}
+}
+
+proc run_request {t cursorpos expectedname} {
+	global stats.total stats.ok stats.fail env
 
 	incr stats.total
-	set cursorpos [string range [file extension [glob "${t}/cursor.*"]] 1 end]
-	set expected [read_file "${t}/out.expected"]
+	set name $t
+	if {$expectedname ne "${t}/out.expected"} {
+		append name " (cursor ${cursorpos})"
+	}
+	if {[catch {read_file $expectedname} expected]} {
+		set expected "To be determined"
+	}
 	set filename "${t}/test.go.in"
+	set args {}
+	foreach a [read_command $t $cursorpos] {
+		lappend args [string map [list {$file} $filename {$cursor} $cursorpos] $a]
+	}
 
-	set out [read_file "| gocode -in ${filename} autocomplete ${filename} ${cursorpos}"]
-	if {$out eq $expected} {
-		print_pass_report $t
-		incr stats.ok
-	} else {
-		print_fail_report $t $out $expected
+	set saved {}
+	foreach {envname value} [read_env $t] {
+		if {[info exists env($envname)]} {
+			lappend saved [list set env($envname) $env($envname)]
+		} else {
+			lappend saved [list unset env($envname)]
+		}
+		set env($envname) $value
+	}
+	set f [open |[list gocode -in $filename {*}$args 2>@1] r]
+	set out [string map [list [file normalize $t] {$dir}] [read $f]]
+	# gocode exits with status 1 on errors
+	catch {close $f}
+	foreach cmd $saved {
+		eval $cmd
+	}
+	if {$out ne $expected} {
+		print_fail_report $name $out $expected
 		incr stats.fail
+	} else {
+		print_pass_report $name
+		incr stats.ok
 	}
 }
 
@@ -0,0 +1,41 @@
+package shapes
+
+import "io"
+
+var DefaultColor = "black"
+
+type Point struct {
+	X, Y int
+}
+
+type Rect struct {
+	Min, Max Point
+}
+
+func NewRect(min, max Point) *Rect {
+	return &Rect{Min: min, Max: max}
+}
+
+func (r *Rect) Size() Point {
+	return Point{r.Max.X - r.Min.X, r.Max.Y - r.Min.Y}
+}
+
+func (r *Rect) WriteTo(w io.Writer) (int64, error) {
+	return 0, nil
+}
+
+type Group[T any] struct {
+	items []T
+}
+
+func (g *Group[T]) Add(item T) {
+	g.items = append(g.items, item)
+}
+
+func (g *Group[T]) Items() []T {
+	return g.items
+}
+
+type shape interface {
+	Size() Point
+}
@@ -0,0 +1,3 @@
+package main
+
+func (t T) TestHelper() {}
@@ -0,0 +1,5 @@
+// +build gocode_never
+
+package main
+
+func (t T) OldStyleTag() {}
@@ -0,0 +1,19 @@
+package foo
+
+import "strconv"
+
+type Counter struct {
+	n int
+}
+
+func (c *Counter) Inc() {
+	c.n++
+}
+
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+func parseStep(s string) (int, error) {
+	return strconv.Atoi(s)
+}
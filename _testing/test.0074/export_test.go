@@ -0,0 +1,9 @@
+package foo
+
+// hooks for the external tests
+
+func (c *Counter) Value() int {
+	return c.n
+}
+
+var ParseStep = parseStep
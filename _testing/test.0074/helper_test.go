@@ -0,0 +1,7 @@
+package foo_test
+
+import foo "."
+
+func newTestCounter() *foo.Counter {
+	return foo.NewCounter()
+}
@@ -0,0 +1,12 @@
+package lock
+
+// Mutex is a mutual exclusion lock.
+type Mutex struct {
+	state int32
+}
+
+func (m *Mutex) Lock() {
+}
+
+func (m *Mutex) Unlock() {
+}
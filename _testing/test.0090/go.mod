@@ -0,0 +1,16 @@
+module example.com/app
+
+go 1.21
+
+require (
+	example.com/lib v1.2.0
+	example.com/local v0.0.0
+	example.com/moved v1.0.0
+	// a pseudo-version of a module without tags
+	example.com/pseudo v0.0.0-20230405060708-0123456789ab // indirect
+	"github.com/User/Upper" v1.0.0
+)
+
+replace example.com/local => ./local
+
+replace example.com/moved v1.0.0 => example.com/other v1.1.0
@@ -0,0 +1,3 @@
+package moved
+
+func Replaced() {}
@@ -0,0 +1,3 @@
+package pseudo
+
+func FromPseudoVersion() {}
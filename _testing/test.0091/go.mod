@@ -0,0 +1,5 @@
+module example.com/app
+
+go 1.14
+
+require example.com/vend v1.0.0
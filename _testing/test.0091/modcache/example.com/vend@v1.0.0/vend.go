@@ -0,0 +1,3 @@
+package vend
+
+func FromModuleCache() {}
@@ -0,0 +1,12 @@
+module example.com/app
+
+go 1.21
+
+require (
+	example.com/dep v1.9.0
+	example.com/lib v1.0.0
+	example.com/pseudo v0.0.0-20230101000000-aaaaaaaaaaaa
+	example.com/repl v1.0.0
+)
+
+replace example.com/repl => ./old
@@ -0,0 +1,8 @@
+module example.com/lib
+
+go 1.21
+
+require (
+	example.com/dep v1.10.0
+	example.com/pseudo v0.0.0-20240101000000-bbbbbbbbbbbb
+)
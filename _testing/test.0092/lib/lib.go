@@ -0,0 +1,5 @@
+package lib
+
+func FromWorkspaceModule() {}
+
+func NotPublishedYet() {}
@@ -0,0 +1,3 @@
+package pseudo
+
+func From2023() {}
@@ -0,0 +1,3 @@
+package repl
+
+func FromModuleReplacement() {}
@@ -0,0 +1,10 @@
+package store
+
+import "io"
+
+type Key string
+
+type Backend interface {
+	Open(name string) (io.ReadCloser, error)
+	Keys() []Key
+}
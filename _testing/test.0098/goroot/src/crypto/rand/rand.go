@@ -0,0 +1,3 @@
+package rand
+
+func Read(b []byte) (int, error) { return 0, nil }
@@ -0,0 +1,5 @@
+package tls
+
+import "crypto/rand"
+
+var _ = rand.Read
@@ -0,0 +1,5 @@
+package x509
+
+import "crypto/rand"
+
+var _ = rand.Read
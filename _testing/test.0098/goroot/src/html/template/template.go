@@ -0,0 +1,3 @@
+package template
+
+func HTMLEscapeString(s string) string { return s }
@@ -0,0 +1,5 @@
+package rand
+
+func Intn(n int) int { return 0 }
+
+func Shuffle(n int, swap func(i, j int)) {}
@@ -0,0 +1,5 @@
+package rpc
+
+import "text/template"
+
+var _ = template.Must
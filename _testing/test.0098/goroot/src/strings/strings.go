@@ -0,0 +1,3 @@
+package strings
+
+func TrimSpace(s string) string { return s }
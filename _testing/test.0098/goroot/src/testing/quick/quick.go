@@ -0,0 +1,9 @@
+package quick
+
+import (
+	"math/rand"
+	"text/template"
+)
+
+var _ = rand.Intn
+var _ = template.Must
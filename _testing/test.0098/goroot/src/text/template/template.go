@@ -0,0 +1,3 @@
+package template
+
+func Must(t interface{}, err error) interface{} { return t }
@@ -0,0 +1,5 @@
+package main
+
+import "math/rand"
+
+var seed = rand.Intn(10)
@@ -0,0 +1,3 @@
+package json
+
+func Marshal(v interface{}) ([]byte, error) { return nil, nil }
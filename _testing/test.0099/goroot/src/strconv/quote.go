@@ -0,0 +1,3 @@
+package strconv
+
+func Quote(s string) string { return s }
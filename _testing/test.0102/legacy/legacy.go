@@ -0,0 +1,24 @@
+// Package legacy is on its way out.
+package legacy
+
+// Open opens the thing.
+func Open() *Reader { return nil }
+
+// OpenFile opens the file.
+//
+// Deprecated: use Open instead.
+func OpenFile(name string) *Reader { return nil }
+
+// Reader reads things.
+type Reader struct {
+	// Size of the buffer.
+	Size int
+}
+
+// Read reads into p.
+func (r *Reader) Read(p []byte) (int, error) { return 0, nil }
+
+// ReadAll reads everything.
+//
+// Deprecated: use Read in a loop.
+func (r *Reader) ReadAll() []byte { return nil }
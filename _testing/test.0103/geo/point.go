@@ -0,0 +1,10 @@
+package geo
+
+// Point is a point on a plane.
+type Point struct {
+	X, Y float64
+}
+
+func (p Point) Add(q Point) Point {
+	return Point{p.X + q.X, p.Y + q.Y}
+}
@@ -0,0 +1,5 @@
+package main
+
+func distance(a, b float64) float64 {
+	return b - a
+}
@@ -0,0 +1,6 @@
+package main
+
+func report(c *config) string {
+	count := c.count
+	return c.name + string(rune(count))
+}
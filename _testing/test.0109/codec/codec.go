@@ -0,0 +1,7 @@
+package codec
+
+import "bytes"
+
+type Encoder interface {
+	Encode(v interface{}, buf *bytes.Buffer) error
+}
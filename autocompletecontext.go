@@ -23,10 +23,20 @@ import (
 
 // fields must be exported for RPC
 type candidate struct {
-	Name    string
-	Type    string
-	Class   decl_class
-	Package string
+	Name      string
+	Type      string
+	Class     decl_class
+	Package   string
+	Score     int
+	TypeMatch bool        // assignable to the type expected at the cursor
+	Snippet   string      // text to insert, see "snippet-syntax" config option
+	Required  bool        // struct literal field of a type without a nil value
+	Edits     []text_edit // other changes to apply, e.g. an import to add
+	Doc       string      // doc comment, see "doc-comments" config option
+
+	Deprecated bool   // the doc comment has a "Deprecated: " paragraph
+	Member     string // "field" or "method" for members of a type
+	Promoted   string // embedded type the member is promoted from
 }
 
 type out_buffers struct {
@@ -36,6 +46,11 @@ type out_buffers struct {
 	ctx               *auto_complete_context
 	tmpns             map[string]bool
 	ignorecase        bool
+	builtin_types     bool // universe types regardless of "propose-builtins"
+
+	// type expected at the cursor, see deduce_expected_type
+	expected       ast.Expr
+	expected_scope *scope
 }
 
 func new_out_buffers(ctx *auto_complete_context) *out_buffers {
@@ -57,6 +72,16 @@ func (b *out_buffers) Len() int {
 func (b *out_buffers) Less(i, j int) bool {
 	x := b.candidates[i]
 	y := b.candidates[j]
+	// candidates which require an import go after all the others
+	if xi, yi := len(x.Edits) != 0, len(y.Edits) != 0; xi != yi {
+		return yi
+	}
+	if x.TypeMatch != y.TypeMatch {
+		return x.TypeMatch
+	}
+	if x.Score != y.Score {
+		return x.Score > y.Score
+	}
 	if x.Class == y.Class {
 		return x.Name < y.Name
 	}
@@ -68,9 +93,14 @@ func (b *out_buffers) Swap(i, j int) {
 }
 
 func (b *out_buffers) append_decl(p, name, pkg string, decl *decl, class decl_class) {
-	c1 := !g_config.ProposeBuiltins && decl.scope == g_universe_scope && decl.name != "Error"
+	c1 := !g_config.ProposeBuiltins && decl.scope == g_universe_scope && decl.name != "Error" &&
+		!(b.builtin_types && decl.class == decl_type)
 	c2 := class != decl_invalid && decl.class != class
-	c3 := class == decl_invalid && !has_prefix(name, p, b.ignorecase)
+	score, matches := 0, true
+	if class == decl_invalid {
+		score, matches = match_candidate(name, p, b.ignorecase)
+	}
+	c3 := !matches
 	c4 := !decl.matches()
 	c5 := !check_type_expr(decl.typ)
 
@@ -79,13 +109,46 @@ func (b *out_buffers) append_decl(p, name, pkg string, decl *decl, class decl_cl
 	}
 
 	decl.pretty_print_type(b.tmpbuf, b.canonical_aliases)
+	typ := b.tmpbuf.String()
+	b.tmpbuf.Reset()
+	b.ctx.load_comments(decl)
 	b.candidates = append(b.candidates, candidate{
-		Name:    name,
-		Type:    b.tmpbuf.String(),
-		Class:   decl.class,
-		Package: pkg,
+		Name:       name,
+		Type:       typ,
+		Class:      decl.class,
+		Package:    pkg,
+		Score:      score,
+		TypeMatch:  b.matches_expected_type(decl),
+		Snippet:    b.snippet(name, typ, decl),
+		Doc:        decl.doc,
+		Deprecated: decl.flags&decl_deprecated != 0,
 	})
-	b.tmpbuf.Reset()
+}
+
+// Proposes a field of the struct literal under the cursor, unless it's set
+// already. Fields of types without a nil value are marked as required.
+func (b *out_buffers) append_field(cc cursor_context, decl *decl, pkg string, class decl_class) {
+	if cc.struct_keys[decl.name] {
+		return
+	}
+	n := len(b.candidates)
+	b.append_decl(cc.partial, decl.name, pkg, decl, class)
+	if len(b.candidates) > n {
+		t, _ := advance_to_type(nilable_predicate, decl.typ, decl.scope)
+		b.candidates[n].Required = t == nil
+	}
+}
+
+// Marks the candidates starting at 'first' as fields or methods.
+func (b *out_buffers) mark_members(first int) {
+	for i := first; i < len(b.candidates); i++ {
+		switch b.candidates[i].Class {
+		case decl_var:
+			b.candidates[i].Member = "field"
+		case decl_func:
+			b.candidates[i].Member = "method"
+		}
+	}
 }
 
 func (b *out_buffers) append_embedded(p string, decl *decl, pkg string, class decl_class) {
@@ -111,6 +174,15 @@ func (b *out_buffers) append_embedded(p string, decl *decl, pkg string, class de
 			continue
 		}
 
+		// the name of the embedded type, members are promoted from it
+		t := emb
+		if se, ok := t.(*ast.StarExpr); ok {
+			t = se.X
+		}
+		pretty_print_type_expr(b.tmpbuf, t, b.canonical_aliases)
+		from := b.tmpbuf.String()
+		b.tmpbuf.Reset()
+
 		// could be type alias
 		if typedecl.is_alias() {
 			typedecl = typedecl.type_dealias()
@@ -127,7 +199,11 @@ func (b *out_buffers) append_embedded(p string, decl *decl, pkg string, class de
 			if _, has := b.tmpns[c.name]; has {
 				continue
 			}
+			n := len(b.candidates)
 			b.append_decl(p, c.name, pkg, c, class)
+			if len(b.candidates) > n {
+				b.candidates[n].Promoted = from
+			}
 			b.tmpns[c.name] = true
 		}
 		b.append_embedded(p, typedecl, pkg, class)
@@ -147,9 +223,10 @@ func (b *out_buffers) append_embedded(p string, decl *decl, pkg string, class de
 //-------------------------------------------------------------------------
 
 type auto_complete_context struct {
-	current *auto_complete_file // currently edited file
-	others  []*decl_file_cache  // other files of the current package
-	pkg     *scope
+	current  *auto_complete_file // currently edited file
+	others   []*decl_file_cache  // other files of the current package
+	excluded []excluded_file     // other files of the current package, which were skipped
+	pkg      *scope
 
 	pcache    package_cache // packages cache
 	declcache *decl_cache   // top-level declarations cache
@@ -170,12 +247,12 @@ func (c *auto_complete_context) update_caches() {
 
 	// collect import information from all of the files
 	c.pcache.append_packages(ps, c.current.packages)
-	c.others = get_other_package_files(c.current.name, c.current.package_name, c.declcache)
+	c.others, c.excluded = get_other_package_files(c.current.name, c.current.package_name, c.declcache)
 	for _, other := range c.others {
 		c.pcache.append_packages(ps, other.packages)
 	}
 
-	update_packages(ps)
+	update_packages_and_imports(ps, c.pcache)
 
 	// fix imports for all files
 	fixup_packages(c.current.filescope, c.current.packages, c.pcache)
@@ -229,18 +306,31 @@ func (c *auto_complete_context) get_candidates_from_decl_alias(cc cursor_context
 		return
 	}
 
+	// mark the alias itself, the dealiased type needs to stay unmarked,
+	// otherwise we can't advance to its underlying type
+	alias := cc.decl
 	cc.decl = cc.decl.type_dealias()
 	if cc.decl == nil {
 		return
 	}
 
-	cc.decl.set_visited()
-	defer cc.decl.clear_visited()
+	alias.set_visited()
+	defer alias.clear_visited()
 
 	c.get_candidates_from_decl(cc, class, b)
 	return
 }
 
+// Comments of packages loaded from archives are read from their source
+// directories on demand, if the "doc-comments" config option is set.
+func (c *auto_complete_context) load_comments(decl *decl) {
+	if g_config.DocComments && decl.flags&decl_foreign != 0 && decl.scope != nil {
+		if pkg, ok := c.pcache[decl.scope.pkgname]; ok {
+			pkg.load_comments()
+		}
+	}
+}
+
 func (c *auto_complete_context) decl_package_import_path(decl *decl) string {
 	if decl == nil || decl.scope == nil {
 		return ""
@@ -256,31 +346,50 @@ func (c *auto_complete_context) get_candidates_from_decl(cc cursor_context, clas
 		c.get_candidates_from_decl_alias(cc, class, b)
 		return
 	}
+	if cc.decl.class != decl_package {
+		defer b.mark_members(len(b.candidates))
+	}
 
 	// propose all children of a subject declaration and
 	for _, decl := range cc.decl.children {
-		if cc.decl.class == decl_package && !ast.IsExported(decl.name) {
-			continue
+		if cc.decl.class == decl_package {
+			if !ast.IsExported(decl.name) {
+				continue
+			}
+			// packages loaded from source may have untyped declarations
+			decl.infer_type()
 		}
 		if cc.struct_field {
 			// if we're autocompleting struct field init, skip all methods
-			if _, ok := decl.typ.(*ast.FuncType); ok {
+			if decl.class == decl_func {
 				continue
 			}
+			b.append_field(cc, decl, c.decl_package_import_path(decl), class)
+			continue
 		}
 		b.append_decl(cc.partial, decl.name, c.decl_package_import_path(decl), decl, class)
 	}
 	// propose all children of an underlying struct/interface type
 	adecl := advance_to_struct_or_interface(cc.decl)
 	if adecl != nil && adecl != cc.decl {
+		// methods of an underlying interface type belong to the method set
+		// as well, this is how type parameters get methods of their
+		// constraints
+		_, iface := adecl.typ.(*ast.InterfaceType)
 		for _, decl := range adecl.children {
-			if decl.class == decl_var {
+			switch {
+			case cc.struct_field && decl.class == decl_var:
+				b.append_field(cc, decl, c.decl_package_import_path(decl), class)
+			case decl.class == decl_var || iface:
 				b.append_decl(cc.partial, decl.name, c.decl_package_import_path(decl), decl, class)
 			}
 		}
 	}
-	// propose all children of its embedded types
-	b.append_embedded(cc.partial, cc.decl, c.decl_package_import_path(cc.decl), class)
+	// propose all children of its embedded types, promoted fields can't be
+	// used in struct literals though
+	if !cc.struct_field {
+		b.append_embedded(cc.partial, cc.decl, c.decl_package_import_path(cc.decl), class)
+	}
 }
 
 func (c *auto_complete_context) get_import_candidates(partial string, b *out_buffers) {
@@ -290,8 +399,280 @@ func (c *auto_complete_context) get_import_candidates(partial string, b *out_buf
 		// convert srcpath to pkgpath and get candidates
 		get_import_candidates_dir(pkgdir, filepath.FromSlash(partial), b.ignorecase, currentPackagePath, resultSet)
 	}
+	for _, root := range g_daemon.context.import_roots() {
+		get_import_candidates_src(root, root.dir, partial, b.ignorecase, resultSet)
+	}
 	for k := range resultSet {
-		b.candidates = append(b.candidates, candidate{Name: k, Class: decl_import})
+		b.candidates = append(b.candidates, candidate{Name: k, Class: decl_import, Snippet: k})
+	}
+}
+
+var g_statement_keywords = []string{
+	"const", "defer", "for", "go", "goto", "if", "return", "select",
+	"switch", "type", "var",
+}
+
+var g_toplevel_keywords = []string{
+	"const", "func", "import", "type", "var",
+}
+
+// Proposes keywords which may appear at the cursor position, only statement
+// and top-level declaration keywords are supported.
+func (c *auto_complete_context) get_keyword_candidates(file []byte, cursor int, partial string, b *out_buffers) {
+	var keywords []string
+	switch {
+	case c.current.stmt_start:
+		keywords = append(keywords, g_statement_keywords...)
+		if c.current.in_break {
+			keywords = append(keywords, "break")
+		}
+		if c.current.in_loop {
+			keywords = append(keywords, "continue")
+		}
+		if c.current.in_case {
+			keywords = append(keywords, "fallthrough")
+		}
+	case c.current.toplevel && cursor_at_decl_start(file, cursor):
+		keywords = g_toplevel_keywords
+	}
+	for _, k := range keywords {
+		if score, ok := match_candidate(k, partial, b.ignorecase); ok {
+			b.candidates = append(b.candidates, candidate{
+				Name:    k,
+				Class:   decl_keyword,
+				Score:   score,
+				Snippet: k,
+			})
+		}
+	}
+}
+
+// Proposes labels of the current function which may follow the 'branch'
+// keyword: any label for goto, the ones of the enclosing statements for
+// break and continue.
+func (c *auto_complete_context) get_label_candidates(branch token.Token, partial string, b *out_buffers) {
+	if c.current.labels == nil {
+		return
+	}
+	for name := range c.current.labels.entities {
+		switch {
+		case branch == token.BREAK && !c.current.break_labels[name]:
+			continue
+		case branch == token.CONTINUE && !c.current.continue_labels[name]:
+			continue
+		}
+		if score, ok := match_candidate(name, partial, b.ignorecase); ok {
+			b.candidates = append(b.candidates, candidate{
+				Name:    name,
+				Class:   decl_label,
+				Score:   score,
+				Snippet: name,
+			})
+		}
+	}
+}
+
+// Proposes constants of the switch tag's type which are not used by other
+// case clauses, they are qualified if declared in another package. With the
+// "propose-all-cases" config option the first candidate is all of them: the
+// name lists them for a single case clause, the snippet adds a case clause
+// per constant.
+func (c *auto_complete_context) get_case_candidates(cc cursor_context, file []byte, cursor int, b *out_buffers) {
+	t := cc.switch_type
+	var consts map[string]*decl
+	qualifier, pkgpath := "", ""
+	var edits []text_edit
+	if p, ok := c.pcache[t.scope.pkgname]; ok && p.main != nil {
+		consts = p.main.children
+		pkgpath = p.import_name
+		qualifier = p.defalias
+		imported := false
+		for _, imp := range c.current.packages {
+			if imp.abspath == t.scope.pkgname {
+				imported = true
+				if imp.alias != "" {
+					qualifier = imp.alias
+				}
+			}
+		}
+		if qualifier == "." {
+			qualifier = ""
+		} else if !imported {
+			// fs.ModeDir for os.FileMode
+			edits = []text_edit{import_edit(file, qualifier, pkgpath)}
+		}
+	} else {
+		consts = c.make_decl_set(c.current.scope)
+	}
+
+	first := len(b.candidates)
+	for name, d := range consts {
+		if d == nil || d.class != decl_const {
+			continue
+		}
+		if pkgpath != "" && !ast.IsExported(name) {
+			continue
+		}
+		d.infer_type()
+		if named_type_decl(d.typ, d.scope) != t {
+			continue
+		}
+		b.append_decl(cc.partial, name, pkgpath, d, decl_invalid)
+	}
+	names := make([]string, 0, len(b.candidates)-first)
+	for i := first; i < len(b.candidates); i++ {
+		cand := &b.candidates[i]
+		if qualifier != "" {
+			cand.Name = qualifier + "." + cand.Name
+			cand.Snippet = qualifier + "." + cand.Snippet
+		}
+		if cc.switch_cases[cand.Name] {
+			b.candidates = append(b.candidates[:i], b.candidates[i+1:]...)
+			i--
+			continue
+		}
+		cand.TypeMatch = true
+		cand.Edits = edits
+		names = append(names, cand.Name)
+	}
+
+	if !g_config.ProposeAllCases || !cc.case_start || cc.partial != "" || len(names) < 2 {
+		return
+	}
+	sort.Strings(names)
+	indent := file[bytes.LastIndexByte(file[:cursor], '\n')+1 : cursor]
+	indent = indent[:len(indent)-len(bytes.TrimLeft(indent, " \t"))]
+	sep := ":\n" + string(indent) + "case "
+	b.candidates = append(b.candidates, candidate{
+		Name:      strings.Join(names, ", "),
+		Class:     decl_const,
+		Package:   pkgpath,
+		Score:     1, // ahead of the constants
+		TypeMatch: true,
+		Snippet:   strings.Join(names, sep) + ":",
+		Edits:     edits,
+	})
+}
+
+// Proposes the types implementing the interface of the type switch or the
+// type assertion, interfaces with more methods included. The types are the
+// ones of the current package, of the imported packages and the built-in
+// ones. A type is proposed as '*T' if it has some of the methods only with
+// a pointer receiver.
+func (c *auto_complete_context) get_assertion_candidates(cc cursor_context, b *out_buffers) {
+	iface := underlying_interface(cc.assert_type)
+	if iface == nil {
+		iface = cc.assert_type
+	}
+	methods := make(map[string]*decl)
+	iface.interface_methods(methods)
+
+	b.builtin_types = true
+	defer func() { b.builtin_types = false }()
+	add := func(name, pkgpath, qualifier string, d *decl) {
+		if d == nil || d.class != decl_type || d == cc.assert_type || d.name == "comparable" && d.scope == g_universe_scope {
+			return
+		}
+		ok, ptr := d.has_methods(methods)
+		if !ok {
+			return
+		}
+		qname := name
+		if qualifier != "" {
+			qname = qualifier + "." + name
+		}
+		if cc.switch_cases[qname] || cc.switch_cases["*"+qname] {
+			return
+		}
+		n := len(b.candidates)
+		b.append_decl(cc.partial, name, pkgpath, d, decl_invalid)
+		for i := n; i < len(b.candidates); i++ {
+			cand := &b.candidates[i]
+			if qualifier != "" {
+				cand.Name = qualifier + "." + cand.Name
+				cand.Snippet = qualifier + "." + cand.Snippet
+			}
+			if ptr {
+				cand.Name = "*" + cand.Name
+				cand.Snippet = "*" + cand.Snippet
+			}
+			cand.TypeMatch = true
+		}
+	}
+	for name, d := range c.make_decl_set(c.current.scope) {
+		add(name, "", "", d)
+	}
+	for _, imp := range c.current.packages {
+		p, ok := c.pcache[imp.abspath]
+		if !ok || p.main == nil {
+			continue
+		}
+		qualifier := imp.alias
+		switch qualifier {
+		case "":
+			qualifier = p.defalias
+		case ".":
+			// declarations are in the file scope already
+			continue
+		}
+		for name, d := range p.main.children {
+			if ast.IsExported(name) {
+				add(name, p.import_name, qualifier, d)
+			}
+		}
+	}
+}
+
+// Loading packages is not free, only so many packages with matching symbols
+// are proposed and only so many of their symbols.
+const (
+	g_max_unimported_packages   = 8
+	g_max_unimported_candidates = 32
+)
+
+// Proposes exported symbols of packages which are not imported yet, found
+// in the package index. The candidates are qualified ("json.Marshal" for
+// "Marsh") and carry the import to add, they go after all the others.
+func (c *auto_complete_context) get_unimported_candidates(file []byte, partial string, class decl_class, b *out_buffers) {
+	entries := g_daemon.pkgindex.lookup_symbol(partial, c.current.context.CurrentPackagePath, b.ignorecase)
+	rank_packages(entries, c.imported_by_others())
+
+	n, first := 0, len(b.candidates)
+	for _, e := range entries {
+		if n == g_max_unimported_packages || len(b.candidates)-first >= g_max_unimported_candidates {
+			break
+		}
+		if c.current.scope.lookup(e.name) != nil {
+			// imported already or the name is taken
+			continue
+		}
+		p := c.load_unimported_package(e)
+		if p == nil {
+			continue
+		}
+		n++
+
+		// only the matching symbols are looked at, the types of the
+		// others are never inferred
+		edit := import_edit(file, e.name, e.path)
+		pfirst := len(b.candidates)
+		for _, name := range e.symbols {
+			if _, ok := match_candidate(name, partial, b.ignorecase); !ok {
+				continue
+			}
+			d := p.main.children[name]
+			if d == nil {
+				continue
+			}
+			d.infer_type()
+			b.append_decl(partial, name, e.path, d, class)
+		}
+		for i := pfirst; i < len(b.candidates); i++ {
+			cand := &b.candidates[i]
+			cand.Name = e.name + "." + cand.Name
+			cand.Snippet = e.name + "." + cand.Snippet
+			cand.Edits = []text_edit{edit}
+		}
 	}
 }
 
@@ -329,6 +710,57 @@ func get_import_candidates_dir(root, partial string, ignorecase bool, currentPac
 	}
 }
 
+// Same as get_import_candidates_dir, but looks for directories with Go source
+// files. Walks only the directories which may contain packages matching the
+// 'partial' import path.
+func get_import_candidates_src(root import_root, dir, partial string, ignorecase bool, r map[string]struct{}) {
+	fi := readdir(dir)
+	has_go_files := false
+	for i := range fi {
+		name := fi[i].Name()
+		if !fi[i].IsDir() {
+			if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				has_go_files = true
+			}
+			continue
+		}
+		switch {
+		case name == "testdata" || name == "vendor":
+			continue
+		case strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_"):
+			continue
+		case root.path == "" && (name == "internal" || dir == root.dir && name == "cmd"):
+			// not importable parts of the standard library
+			continue
+		}
+		subdir := filepath.Join(dir, name)
+		if file_exists(filepath.Join(subdir, "go.mod")) {
+			// nested module
+			continue
+		}
+		ipath := import_path_in_root(root, subdir)
+		if has_prefix(ipath, partial, ignorecase) || has_prefix(partial, ipath+"/", ignorecase) {
+			get_import_candidates_src(root, subdir, partial, ignorecase, r)
+		}
+	}
+	if ipath := import_path_in_root(root, dir); has_go_files && ipath != "" {
+		if has_prefix(ipath, partial, ignorecase) {
+			r[ipath] = struct{}{}
+		}
+	}
+}
+
+func import_path_in_root(root import_root, dir string) string {
+	rel, err := filepath.Rel(root.dir, dir)
+	if err != nil || rel == "." {
+		return root.path
+	}
+	if root.path == "" {
+		return filepath.ToSlash(rel)
+	}
+	return root.path + "/" + filepath.ToSlash(rel)
+}
+
 // returns three slices of the same length containing:
 // 1. apropos names
 // 2. apropos types (pretty-printed)
@@ -344,11 +776,8 @@ func (c *auto_complete_context) apropos(file []byte, filename string, cursor int
 	// will be better in future.
 
 	// Ugly hack, but it actually may help in some cases. Insert a
-	// semicolon right at the cursor location.
-	filesemi := make([]byte, len(file)+1)
-	copy(filesemi, file[:cursor])
-	filesemi[cursor] = ';'
-	copy(filesemi[cursor+1:], file[cursor:])
+	// semicolon right at the cursor location, see cursor_filler.
+	filesemi := with_cursor_filler(file, cursor)
 
 	// Does full processing of the currently edited file (top-level declarations plus
 	// active function).
@@ -377,12 +806,14 @@ func (c *auto_complete_context) apropos(file []byte, filename string, cursor int
 		}
 		cc.partial = ""
 	}
+	var import_name, import_path string
 	if !ok {
 		var d *decl
 		if ident, ok := cc.expr.(*ast.Ident); ok && g_config.UnimportedPackages {
-			p := resolveKnownPackageIdent(ident.Name, c.current.name, c.current.context)
+			var p *package_file_cache
+			p, import_path = c.resolve_unimported_package(ident.Name)
+			import_name = ident.Name
 			if p != nil {
-				c.pcache[p.name] = p
 				d = p.main
 			}
 		}
@@ -408,7 +839,28 @@ func (c *auto_complete_context) apropos(file []byte, filename string, cursor int
 		}
 	}
 
-	if cc.decl_import {
+	if cc.label != token.ILLEGAL {
+		c.get_label_candidates(cc.label, cc.partial, b)
+		if cc.partial != "" && len(b.candidates) == 0 {
+			// as a fallback, try case insensitive approach
+			b.ignorecase = true
+			c.get_label_candidates(cc.label, cc.partial, b)
+		}
+	} else if cc.assert_type != nil {
+		c.get_assertion_candidates(cc, b)
+		if cc.partial != "" && len(b.candidates) == 0 {
+			// as a fallback, try case insensitive approach
+			b.ignorecase = true
+			c.get_assertion_candidates(cc, b)
+		}
+	} else if cc.switch_type != nil {
+		c.get_case_candidates(cc, file, cursor, b)
+		if cc.partial != "" && len(b.candidates) == 0 {
+			// as a fallback, try case insensitive approach
+			b.ignorecase = true
+			c.get_case_candidates(cc, file, cursor, b)
+		}
+	} else if cc.decl_import {
 		c.get_import_candidates(cc.partial, b)
 		if cc.partial != "" && len(b.candidates) == 0 {
 			// as a fallback, try case insensitive approach
@@ -417,14 +869,34 @@ func (c *auto_complete_context) apropos(file []byte, filename string, cursor int
 		}
 	} else if cc.decl == nil {
 		// In case if no declaraion is a subject of completion, propose all:
+		b.expected, b.expected_scope = c.deduce_expected_type(file, cursor)
 		set := c.make_decl_set(c.current.scope)
 		c.get_candidates_from_set(set, cc.partial, class, b)
+		// without partial input keywords and symbols of unimported
+		// packages would only clutter the list
+		keywords := class == decl_invalid && partial != 0
+		if keywords {
+			c.get_keyword_candidates(file, cursor, cc.partial, b)
+		}
+		unimported := g_config.UnimportedPackages && cc.partial != ""
+		if unimported {
+			c.get_unimported_candidates(file, cc.partial, class, b)
+		}
 		if cc.partial != "" && len(b.candidates) == 0 {
 			// as a fallback, try case insensitive approach
 			b.ignorecase = true
 			c.get_candidates_from_set(set, cc.partial, class, b)
+			if keywords {
+				c.get_keyword_candidates(file, cursor, cc.partial, b)
+			}
+			if unimported {
+				c.get_unimported_candidates(file, cc.partial, class, b)
+			}
 		}
 	} else {
+		if !cc.struct_field {
+			b.expected, b.expected_scope = c.deduce_expected_type(file, cursor)
+		}
 		c.get_candidates_from_decl(cc, class, b)
 		if cc.partial != "" && len(b.candidates) == 0 {
 			// as a fallback, try case insensitive approach
@@ -436,11 +908,48 @@ func (c *auto_complete_context) apropos(file []byte, filename string, cursor int
 	if len(b.candidates) == 0 {
 		return nil, 0
 	}
+	if import_path != "" {
+		// the package has to be imported
+		edit := import_edit(file, import_name, import_path)
+		for i := range b.candidates {
+			b.candidates[i].Edits = []text_edit{edit}
+		}
+	}
 
 	sort.Sort(b)
 	return b.candidates, partial
 }
 
+// Returns a copy of the file with a filler inserted at the cursor, see
+// cursor_filler.
+func with_cursor_filler(file []byte, cursor int) []byte {
+	filesemi := make([]byte, len(file)+1)
+	copy(filesemi, file[:cursor])
+	filesemi[cursor] = cursor_filler(file[:cursor])
+	copy(filesemi[cursor+1:], file[cursor:])
+	return filesemi
+}
+
+// Returns a character to insert at the cursor position before parsing, a
+// semicolon unless an operand is expected there (e.g. "w.Write(#)" or
+// "case #"). A blank identifier keeps the parser from losing the enclosing
+// function then, its scope and results are needed to deduce the expected
+// type.
+func cursor_filler(before []byte) byte {
+	trimmed := bytes.TrimRight(before, " \t\r\n")
+	if len(trimmed) > 0 {
+		switch trimmed[len(trimmed)-1] {
+		case '(', ',', ':', '=':
+			return '_'
+		}
+	}
+	word := trimmed[bytes.LastIndexAny(trimmed, " \t\r\n;{}")+1:]
+	if len(trimmed) < len(before) && string(word) == "case" {
+		return '_'
+	}
+	return ';'
+}
+
 func update_packages(ps map[string]*package_file_cache) {
 	// initiate package cache update
 	done := make(chan bool)
@@ -465,6 +974,34 @@ func update_packages(ps map[string]*package_file_cache) {
 	}
 }
 
+// Updates packages in 'ps' and all the packages imported by the ones loaded
+// from source, archives are self-contained, but source packages aren't. The
+// latter are added to 'ps' as well.
+func update_packages_and_imports(ps map[string]*package_file_cache, pcache package_cache) {
+	for pending := ps; len(pending) != 0; {
+		update_packages(pending)
+
+		next := make(map[string]*package_file_cache)
+		for _, p := range pending {
+			for _, f := range p.files {
+				pcache.append_packages(next, f.packages)
+			}
+		}
+		for key, p := range next {
+			if _, ok := ps[key]; ok {
+				delete(next, key)
+				continue
+			}
+			ps[key] = p
+		}
+		pending = next
+	}
+
+	for _, p := range ps {
+		p.fixup_imports(pcache)
+	}
+}
+
 func collect_type_alias_methods(d *decl) map[string]*decl {
 	if d == nil || d.is_visited() || !d.is_alias() {
 		return nil
@@ -550,8 +1087,8 @@ func fixup_packages(filescope *scope, pkgs []package_import, pcache package_cach
 	}
 }
 
-func get_other_package_files(filename, packageName string, declcache *decl_cache) []*decl_file_cache {
-	others := find_other_package_files(filename, packageName)
+func get_other_package_files(filename, packageName string, declcache *decl_cache) ([]*decl_file_cache, []excluded_file) {
+	others, excluded := find_other_package_files(filename, packageName, declcache.context)
 
 	ret := make([]*decl_file_cache, len(others))
 	done := make(chan *decl_file_cache)
@@ -575,15 +1112,25 @@ func get_other_package_files(filename, packageName string, declcache *decl_cache
 		}
 	}
 
-	return ret
+	return ret, excluded
+}
+
+type excluded_file struct {
+	name   string
+	reason string
 }
 
-func find_other_package_files(filename, package_name string) []string {
+// Returns other files of the package 'package_name' in the directory of
+// 'filename', which match the build context. Test files (unless 'filename' is
+// a test file too) and files excluded by build constraints (file name
+// suffixes and "//go:build" lines) are returned separately.
+func find_other_package_files(filename, package_name string, context *package_lookup_context) ([]string, []excluded_file) {
 	if filename == "" {
-		return nil
+		return nil, nil
 	}
 
 	dir, file := filepath.Split(filename)
+	is_test := strings.HasSuffix(file, "_test.go") || strings.HasSuffix(package_name, "_test")
 	files_in_dir, err := readdir_lstat(dir)
 	if err != nil {
 		panic(err)
@@ -599,6 +1146,7 @@ func find_other_package_files(filename, package_name string) []string {
 	}
 
 	out := make([]string, 0, count)
+	var excluded []excluded_file
 	for _, stat := range files_in_dir {
 		const non_regular = os.ModeDir | os.ModeSymlink |
 			os.ModeDevice | os.ModeNamedPipe | os.ModeSocket
@@ -609,14 +1157,23 @@ func find_other_package_files(filename, package_name string) []string {
 		}
 
 		abspath := filepath.Join(dir, stat.Name())
-		if file_package_name(abspath) == package_name {
-			n := len(out)
-			out = out[:n+1]
-			out[n] = abspath
+		if file_package_name(abspath) != package_name {
+			continue
 		}
+		if strings.HasSuffix(stat.Name(), "_test.go") && !is_test {
+			excluded = append(excluded, excluded_file{abspath, "test file"})
+			continue
+		}
+		if match, err := context.MatchFile(dir, stat.Name()); err != nil || !match {
+			excluded = append(excluded, excluded_file{abspath, "build constraints"})
+			continue
+		}
+		n := len(out)
+		out = out[:n+1]
+		out[n] = abspath
 	}
 
-	return out
+	return out, excluded
 }
 
 func file_package_name(filename string) string {
@@ -753,6 +1310,12 @@ func (c *auto_complete_context) status() string {
 		for _, f := range c.others {
 			fmt.Fprintf(buf, "\t%s\n", f.name)
 		}
+		if len(c.excluded) > 0 {
+			fmt.Fprintf(buf, "\nExcluded files from the current package:\n")
+		}
+		for _, f := range c.excluded {
+			fmt.Fprintf(buf, "\t%s (%s)\n", f.name, f.reason)
+		}
 		fmt.Fprintf(buf, "\nListing declarations from files:\n")
 
 		const status_decls = "\t%s%s" + color_none + " " + color_yellow + "%s" + color_none + "\n"
@@ -44,6 +44,24 @@ type auto_complete_file struct {
 	filescope *scope
 	scope     *scope
 
+	// results of the innermost function the cursor is in and the scope
+	// they make sense in
+	results       *ast.FieldList
+	results_scope *scope
+
+	// syntactic position of the cursor, used for keyword completion
+	toplevel   bool // outside of any declaration block
+	stmt_start bool // at the beginning of a statement
+	in_loop    bool // "continue" is allowed
+	in_break   bool // "break" is allowed
+	in_case    bool // "fallthrough" is allowed
+
+	// labels of the innermost function the cursor is in, the ones of the
+	// enclosing statements are valid targets of break and continue
+	labels          *scope
+	break_labels    map[string]bool
+	continue_labels map[string]bool
+
 	cursor  int // for current file buffer only
 	fset    *token.FileSet
 	context *package_lookup_context
@@ -66,7 +84,8 @@ func (f *auto_complete_file) offset(p token.Pos) int {
 // this one is used for current file buffer exclusively
 func (f *auto_complete_file) process_data(data []byte) {
 	cur, filedata, block := rip_off_decl(data, f.cursor)
-	file, err := parser.ParseFile(f.fset, "", filedata, parser.AllErrors)
+	outer := f.fset.Base()
+	file, err := parser.ParseFile(f.fset, "", filedata, parser.AllErrors|doc_parser_mode())
 	if err != nil && *g_debug {
 		log_parse_error("Error parsing input file (outer block)", err)
 	}
@@ -74,8 +93,14 @@ func (f *auto_complete_file) process_data(data []byte) {
 
 	f.decls = make(map[string]*decl)
 	f.packages = collect_package_imports(f.name, file.Decls, f.context)
+	redirect_package_under_test(f.name, f.package_name, f.packages, f.context)
 	f.filescope = new_scope(nil)
+	f.filescope.position = f.position_func(data, outer, f.fset.Base(), f.cursor-cur, len(block))
 	f.scope = f.filescope
+	f.results, f.results_scope = nil, nil
+	f.toplevel = block == nil
+	f.stmt_start, f.in_loop, f.in_break, f.in_case = false, false, false, false
+	f.labels, f.break_labels, f.continue_labels = nil, nil, nil
 
 	for _, d := range file.Decls {
 		anonymify_ast(d, 0, f.filescope)
@@ -109,16 +134,41 @@ func (f *auto_complete_file) process_data(data []byte) {
 
 }
 
+// Positions of the declarations are reported for the original file 'data',
+// the outer block starts at 'outer' in the file set and the inner one, cut out
+// of it at 'beg', is parsed after it starting at 'inner'.
+func (f *auto_complete_file) position_func(data []byte, outer, inner, beg, ripped int) func(token.Pos) token.Position {
+	orig := token.NewFileSet().AddFile(f.name, -1, len(data))
+	orig.SetLinesForContent(data)
+	return func(p token.Pos) token.Position {
+		var offset int
+		if int(p) >= inner {
+			const fixlen = len("package p;")
+			offset = int(p) - inner - fixlen + beg
+		} else if offset = int(p) - outer; ripped > 0 && offset >= beg {
+			offset += ripped
+		}
+		if offset < 0 || offset > len(data) {
+			return token.Position{}
+		}
+		return orig.Position(orig.Pos(offset))
+	}
+}
+
 func (f *auto_complete_file) process_decl_locals(decl ast.Decl) {
 	switch t := decl.(type) {
 	case *ast.FuncDecl:
 		if f.cursor_in(t.Body) {
+			f.process_type_params(t)
+
 			s := f.scope
 			f.scope = new_scope(f.scope)
+			f.results, f.results_scope = t.Type.Results, s
 
 			f.process_field_list(t.Recv, s)
 			f.process_field_list(t.Type.Params, s)
 			f.process_field_list(t.Type.Results, s)
+			f.process_labels(t.Body)
 			f.process_block_stmt(t.Body)
 		}
 	default:
@@ -128,10 +178,98 @@ func (f *auto_complete_file) process_decl_locals(decl ast.Decl) {
 	}
 }
 
+// Type parameters of a generic function and receiver type parameters of a
+// method of a generic type go into their own scope, they are visible in the
+// signature as well as in the body. Each one is a type with its constraint
+// as the underlying type.
+func (f *auto_complete_file) process_type_params(t *ast.FuncDecl) {
+	var names []*ast.Ident
+	var constraints []ast.Expr
+	if tparams := ast_decl_type_params(t); tparams != nil {
+		// constraints of receiver type parameters are known only if the
+		// receiver type is declared in the current file
+		var ctypes []ast.Expr
+		recv := method_of(t)
+		if d, ok := f.decls[recv]; ok && d.tparams != nil {
+			ctypes = field_list_types(d.tparams)
+		}
+		for i, name := range tparams.List[0].Names {
+			names = append(names, name)
+			if i < len(ctypes) {
+				constraints = append(constraints, ctypes[i])
+			} else {
+				constraints = append(constraints, nil)
+			}
+		}
+	}
+	if t.Type.TypeParams != nil {
+		for _, field := range t.Type.TypeParams.List {
+			for _, name := range field.Names {
+				names = append(names, name)
+				constraints = append(constraints, field.Type)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	s := f.scope
+	f.scope = new_scope(f.scope)
+	for i, name := range names {
+		d := new_decl_full(name.Name, decl_type, 0, constraints[i], nil, -1, s)
+		if d != nil {
+			d.set_pos(name.Pos())
+			f.scope.add_named_decl(d)
+		}
+	}
+}
+
+// Labels have a scope of their own, which is the function body, labels of
+// nested function literals don't belong to it.
+func (f *auto_complete_file) process_labels(body *ast.BlockStmt) {
+	f.labels = new_scope(nil)
+	f.labels.position = f.filescope.position
+	f.break_labels = make(map[string]bool)
+	f.continue_labels = make(map[string]bool)
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch t := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.LabeledStmt:
+			name := t.Label.Name
+			d := new_decl(name, decl_label, f.labels)
+			d.set_pos(t.Label.Pos())
+			f.labels.add_named_decl(d)
+			switch s := t.Stmt.(type) {
+			case *ast.ForStmt:
+				f.continue_labels[name] = f.cursor_in(s.Body)
+				f.break_labels[name] = f.cursor_in(s.Body)
+			case *ast.RangeStmt:
+				f.continue_labels[name] = f.cursor_in(s.Body)
+				f.break_labels[name] = f.cursor_in(s.Body)
+			case *ast.SwitchStmt:
+				f.break_labels[name] = f.cursor_in(s.Body)
+			case *ast.TypeSwitchStmt:
+				f.break_labels[name] = f.cursor_in(s.Body)
+			case *ast.SelectStmt:
+				f.break_labels[name] = f.cursor_in(s.Body)
+			}
+		}
+		return true
+	})
+}
+
 func (f *auto_complete_file) process_decl(decl ast.Decl) {
 	if t, ok := decl.(*ast.GenDecl); ok && f.offset(t.TokPos) > f.cursor {
 		return
 	}
+	f.declare_decl(decl)
+}
+
+// Adds the declarations of a local declaration statement to the scope, each
+// variable or constant advances the scope.
+func (f *auto_complete_file) declare_decl(decl ast.Decl) {
 	prevscope := f.scope
 	foreach_decl(decl, func(data *foreach_decl_struct) {
 		class := ast_decl_class(data.decl)
@@ -145,6 +283,8 @@ func (f *auto_complete_file) process_decl(decl ast.Decl) {
 			if d == nil {
 				return
 			}
+			d.set_pos(name.Pos())
+			d.const_value = data.const_value(i)
 
 			f.scope.add_named_decl(d)
 		}
@@ -154,6 +294,8 @@ func (f *auto_complete_file) process_decl(decl ast.Decl) {
 func (f *auto_complete_file) process_block_stmt(block *ast.BlockStmt) {
 	if block != nil && f.cursor_in(block) {
 		f.scope, _ = advance_scope(f.scope)
+		f.stmt_start = f.cursor_at_stmt_start(block.List)
+		f.in_case = false
 
 		for _, stmt := range block.List {
 			f.process_stmt(stmt)
@@ -174,9 +316,12 @@ func (v *func_lit_visitor) Visit(node ast.Node) ast.Visitor {
 	if t, ok := node.(*ast.FuncLit); ok && v.ctx.cursor_in(t.Body) {
 		s := v.ctx.scope
 		v.ctx.scope = new_scope(v.ctx.scope)
+		v.ctx.results, v.ctx.results_scope = t.Type.Results, s
+		v.ctx.in_loop, v.ctx.in_break, v.ctx.in_case = false, false, false
 
 		v.ctx.process_field_list(t.Type.Params, s)
 		v.ctx.process_field_list(t.Type.Results, s)
+		v.ctx.process_labels(t.Body)
 		v.ctx.process_block_stmt(t.Body)
 
 		return nil
@@ -208,6 +353,7 @@ func (f *auto_complete_file) process_stmt(stmt ast.Stmt) {
 			f.process_stmt(t.Init)
 		} else if f.cursor_in(t.Body) {
 			f.scope, _ = advance_scope(f.scope)
+			f.in_loop, f.in_break, f.in_case = true, true, false
 
 			f.process_stmt(t.Init)
 			f.process_block_stmt(t.Body)
@@ -238,15 +384,10 @@ func (f *auto_complete_file) process_select_stmt(a *ast.SelectStmt) {
 	}
 
 	if last_cursor_after != nil {
-		if last_cursor_after.Comm != nil {
-			//if lastCursorAfter.Lhs != nil && lastCursorAfter.Tok == token.DEFINE {
-			if astmt, ok := last_cursor_after.Comm.(*ast.AssignStmt); ok && astmt.Tok == token.DEFINE {
-				vname := astmt.Lhs[0].(*ast.Ident).Name
-				v := new_decl_var(vname, nil, astmt.Rhs[0], -1, prevscope)
-				if v != nil {
-					f.scope.add_named_decl(v)
-				}
-			}
+		f.stmt_start = f.cursor_at_stmt_start(last_cursor_after.Body)
+		f.in_break, f.in_case = true, false
+		if v := comm_clause_var(last_cursor_after, prevscope); v != nil {
+			f.scope.add_named_decl(v)
 		}
 		for _, s := range last_cursor_after.Body {
 			f.process_stmt(s)
@@ -254,6 +395,21 @@ func (f *auto_complete_file) process_select_stmt(a *ast.SelectStmt) {
 	}
 }
 
+// Returns the variable declared by the communication of the clause, "case v
+// := <-ch:", nil if there is none.
+func comm_clause_var(cc *ast.CommClause, s *scope) *decl {
+	astmt, ok := cc.Comm.(*ast.AssignStmt)
+	if !ok || astmt.Tok != token.DEFINE {
+		return nil
+	}
+	vname := astmt.Lhs[0].(*ast.Ident).Name
+	v := new_decl_var(vname, nil, astmt.Rhs[0], -1, s)
+	if v != nil {
+		v.set_pos(astmt.Lhs[0].Pos())
+	}
+	return v
+}
+
 func (f *auto_complete_file) process_type_switch_stmt(a *ast.TypeSwitchStmt) {
 	if !f.cursor_in(a.Body) {
 		return
@@ -262,16 +418,6 @@ func (f *auto_complete_file) process_type_switch_stmt(a *ast.TypeSwitchStmt) {
 	f.scope, prevscope = advance_scope(f.scope)
 
 	f.process_stmt(a.Init)
-	// type var
-	var tv *decl
-	if a, ok := a.Assign.(*ast.AssignStmt); ok {
-		lhs := a.Lhs
-		rhs := a.Rhs
-		if lhs != nil && len(lhs) == 1 {
-			tvname := lhs[0].(*ast.Ident).Name
-			tv = new_decl_var(tvname, nil, rhs[0], -1, prevscope)
-		}
-	}
 
 	var last_cursor_after *ast.CaseClause
 	for _, s := range a.Body.List {
@@ -281,11 +427,9 @@ func (f *auto_complete_file) process_type_switch_stmt(a *ast.TypeSwitchStmt) {
 	}
 
 	if last_cursor_after != nil {
-		if tv != nil {
-			if last_cursor_after.List != nil && len(last_cursor_after.List) == 1 {
-				tv.typ = last_cursor_after.List[0]
-				tv.value = nil
-			}
+		f.stmt_start = f.cursor_at_stmt_start(last_cursor_after.Body)
+		f.in_break, f.in_case = true, false
+		if tv := type_switch_var(a, last_cursor_after, prevscope); tv != nil {
 			f.scope.add_named_decl(tv)
 		}
 		for _, s := range last_cursor_after.Body {
@@ -294,6 +438,27 @@ func (f *auto_complete_file) process_type_switch_stmt(a *ast.TypeSwitchStmt) {
 	}
 }
 
+// Returns the variable declared by the type switch, "switch v := x.(type)",
+// as it is in the clause: of the type of the case if there is only one, nil
+// if the switch declares no variable.
+func type_switch_var(a *ast.TypeSwitchStmt, cc *ast.CaseClause, s *scope) *decl {
+	assign, ok := a.Assign.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 1 {
+		return nil
+	}
+	tvname := assign.Lhs[0].(*ast.Ident).Name
+	tv := new_decl_var(tvname, nil, assign.Rhs[0], -1, s)
+	if tv == nil {
+		return nil
+	}
+	tv.set_pos(assign.Lhs[0].Pos())
+	if len(cc.List) == 1 {
+		tv.typ = cc.List[0]
+		tv.value = nil
+	}
+	return tv
+}
+
 func (f *auto_complete_file) process_switch_stmt(a *ast.SwitchStmt) {
 	if !f.cursor_in(a.Body) {
 		return
@@ -308,6 +473,10 @@ func (f *auto_complete_file) process_switch_stmt(a *ast.SwitchStmt) {
 		}
 	}
 	if last_cursor_after != nil {
+		f.stmt_start = f.cursor_at_stmt_start(last_cursor_after.Body)
+		// there is nothing to fall through to from the last clause
+		f.in_break = true
+		f.in_case = last_cursor_after != a.Body.List[len(a.Body.List)-1]
 		for _, s := range last_cursor_after.Body {
 			f.process_stmt(s)
 		}
@@ -320,35 +489,48 @@ func (f *auto_complete_file) process_range_stmt(a *ast.RangeStmt) {
 	}
 	var prevscope *scope
 	f.scope, prevscope = advance_scope(f.scope)
+	f.declare_range_vars(a, prevscope)
+
+	f.in_loop, f.in_break, f.in_case = true, true, false
+	f.process_block_stmt(a.Body)
+}
+
+// Adds the key and the value variables of "for k, v := range x" to the
+// scope, 's' is the scope 'x' makes sense in.
+func (f *auto_complete_file) declare_range_vars(a *ast.RangeStmt, s *scope) {
+	if a.Tok != token.DEFINE {
+		return
+	}
+	if t, ok := a.Key.(*ast.Ident); ok {
+		d := new_decl_var(t.Name, nil, a.X, 0, s)
+		if d != nil {
+			d.set_pos(t.Pos())
+			d.flags |= decl_rangevar
+			f.scope.add_named_decl(d)
+		}
+	}
 
-	if a.Tok == token.DEFINE {
-		if t, ok := a.Key.(*ast.Ident); ok {
-			d := new_decl_var(t.Name, nil, a.X, 0, prevscope)
+	if a.Value != nil {
+		if t, ok := a.Value.(*ast.Ident); ok {
+			d := new_decl_var(t.Name, nil, a.X, 1, s)
 			if d != nil {
+				d.set_pos(t.Pos())
 				d.flags |= decl_rangevar
 				f.scope.add_named_decl(d)
 			}
 		}
-
-		if a.Value != nil {
-			if t, ok := a.Value.(*ast.Ident); ok {
-				d := new_decl_var(t.Name, nil, a.X, 1, prevscope)
-				if d != nil {
-					d.flags |= decl_rangevar
-					f.scope.add_named_decl(d)
-				}
-			}
-		}
 	}
-
-	f.process_block_stmt(a.Body)
 }
 
 func (f *auto_complete_file) process_assign_stmt(a *ast.AssignStmt) {
 	if a.Tok != token.DEFINE || f.offset(a.TokPos) > f.cursor {
 		return
 	}
+	f.declare_assign(a)
+}
 
+// Adds the variables of a short variable declaration to the scope.
+func (f *auto_complete_file) declare_assign(a *ast.AssignStmt) {
 	names := make([]*ast.Ident, len(a.Lhs))
 	for i, name := range a.Lhs {
 		id, ok := name.(*ast.Ident)
@@ -369,6 +551,7 @@ func (f *auto_complete_file) process_assign_stmt(a *ast.AssignStmt) {
 		if d == nil {
 			continue
 		}
+		d.set_pos(name.Pos())
 
 		f.scope.add_named_decl(d)
 	}
@@ -408,6 +591,25 @@ func (f *auto_complete_file) cursor_in_for_head(s *ast.ForStmt) bool {
 	return false
 }
 
+// Checks if the cursor is at the beginning of a statement of the list: it's
+// either between statements or on an identifier, which is a statement on its
+// own (a partially typed keyword).
+func (f *auto_complete_file) cursor_at_stmt_start(list []ast.Stmt) bool {
+	for _, stmt := range list {
+		if f.cursor < f.offset(stmt.Pos()) {
+			return true
+		}
+		if f.cursor <= f.offset(stmt.End()) {
+			if s, ok := stmt.(*ast.ExprStmt); ok {
+				_, ok = s.X.(*ast.Ident)
+				return ok
+			}
+			return false
+		}
+	}
+	return true
+}
+
 func (f *auto_complete_file) cursor_in(block *ast.BlockStmt) bool {
 	if f.cursor == -1 || block == nil {
 		return false
@@ -52,6 +52,16 @@ func do_client() int {
 			cmd_set(client)
 		case "options":
 			cmd_options(client)
+		case "impl":
+			return cmd_impl(client)
+		case "definition":
+			return cmd_definition(client)
+		case "type":
+			return cmd_type(client)
+		case "signature":
+			return cmd_signature(client)
+		case "references":
+			return cmd_references(client)
 		default:
 			fmt.Printf("unknown argument: %q, try running \"gocode -h\"\n", flag.Arg(0))
 			return 1
@@ -103,7 +113,9 @@ func try_to_connect(network, address string) (client *rpc.Client, err error) {
 	return
 }
 
-func prepare_file_filename_cursor() ([]byte, string, int) {
+// Reads the file from the path given by the "-in" flag or from stdin, returns
+// its contents without a shebang line and the number of bytes skipped.
+func read_input_file() ([]byte, int) {
 	var file []byte
 	var err error
 
@@ -116,10 +128,19 @@ func prepare_file_filename_cursor() ([]byte, string, int) {
 	if err != nil {
 		panic(err.Error())
 	}
+	return filter_out_shebang(file)
+}
 
-	var skipped int
-	file, skipped = filter_out_shebang(file)
+func abs_filename(filename string) string {
+	if filename != "" && !filepath.IsAbs(filename) {
+		cwd, _ := os.Getwd()
+		filename = filepath.Join(cwd, filename)
+	}
+	return filename
+}
 
+func prepare_file_filename_cursor() ([]byte, string, int) {
+	file, skipped := read_input_file()
 	filename := *g_input
 	cursor := -1
 
@@ -142,11 +163,7 @@ func prepare_file_filename_cursor() ([]byte, string, int) {
 	}
 
 	cursor -= skipped
-	if filename != "" && !filepath.IsAbs(filename) {
-		cwd, _ := os.Getwd()
-		filename = filepath.Join(cwd, filename)
-	}
-	return file, filename, cursor
+	return file, abs_filename(filename), cursor
 }
 
 //-------------------------------------------------------------------------
@@ -186,3 +203,90 @@ func cmd_set(c *rpc.Client) {
 func cmd_options(c *rpc.Client) {
 	fmt.Print(client_options(c, 0))
 }
+
+func cmd_impl(c *rpc.Client) int {
+	filename := *g_input
+	var recv, iface string
+	switch flag.NArg() {
+	case 3:
+		recv, iface = flag.Arg(1), flag.Arg(2)
+	case 4:
+		filename, recv, iface = flag.Arg(1), flag.Arg(2), flag.Arg(3)
+	default:
+		fmt.Fprintf(os.Stderr, "usage: gocode impl [<path>] <recv> <iface>\n")
+		return 1
+	}
+	context := pack_build_context(&build.Default)
+	file, _ := read_input_file()
+	stubs, err := client_impl(c, file, abs_filename(filename), recv, iface, context)
+	if err != "" {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	fmt.Print(stubs)
+	return 0
+}
+
+func cmd_definition(c *rpc.Client) int {
+	if flag.NArg() != 2 && flag.NArg() != 3 {
+		fmt.Fprintf(os.Stderr, "usage: gocode definition [<path>] <offset>\n")
+		return 1
+	}
+	context := pack_build_context(&build.Default)
+	file, filename, cursor := prepare_file_filename_cursor()
+	pos, err := client_definition(c, file, filename, cursor, context)
+	if err != "" {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	fmt.Printf("%s\n", pos)
+	return 0
+}
+
+func cmd_type(c *rpc.Client) int {
+	if flag.NArg() != 2 && flag.NArg() != 3 {
+		fmt.Fprintf(os.Stderr, "usage: gocode type [<path>] <offset>\n")
+		return 1
+	}
+	context := pack_build_context(&build.Default)
+	file, filename, cursor := prepare_file_filename_cursor()
+	t, err := client_type(c, file, filename, cursor, context)
+	if err != "" {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	write_type_info(*g_format, t)
+	return 0
+}
+
+func cmd_signature(c *rpc.Client) int {
+	if flag.NArg() != 2 && flag.NArg() != 3 {
+		fmt.Fprintf(os.Stderr, "usage: gocode signature [<path>] <offset>\n")
+		return 1
+	}
+	context := pack_build_context(&build.Default)
+	file, filename, cursor := prepare_file_filename_cursor()
+	s, err := client_signature(c, file, filename, cursor, context)
+	if err != "" {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	write_signatures(*g_format, s)
+	return 0
+}
+
+func cmd_references(c *rpc.Client) int {
+	if flag.NArg() != 2 && flag.NArg() != 3 {
+		fmt.Fprintf(os.Stderr, "usage: gocode references [<path>] <offset>\n")
+		return 1
+	}
+	context := pack_build_context(&build.Default)
+	file, filename, cursor := prepare_file_filename_cursor()
+	refs, err := client_references(c, file, filename, cursor, context)
+	if err != "" {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	write_references(*g_format, refs)
+	return 0
+}
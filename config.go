@@ -32,6 +32,10 @@ type config struct {
 	Partials           bool   `json:"partials"`
 	IgnoreCase         bool   `json:"ignore-case"`
 	ClassFiltering     bool   `json:"class-filtering"`
+	Matcher            string `json:"matcher"`
+	SnippetSyntax      string `json:"snippet-syntax"`
+	ProposeAllCases    bool   `json:"propose-all-cases"`
+	DocComments        bool   `json:"doc-comments"`
 }
 
 var g_config_desc = map[string]string{
@@ -41,12 +45,16 @@ var g_config_desc = map[string]string{
 	"custom-vendor-dir":   "",
 	"autobuild":           "If set to {true}, gocode will try to automatically build out-of-date packages when their source files are modified, in order to obtain the freshest autocomplete results for them. This feature is experimental.",
 	"force-debug-output":  "If is not empty, gocode will forcefully redirect the logging into that file. Also forces enabling of the debug mode on the server side.",
-	"package-lookup-mode": "If set to {go}, use standard Go package lookup rules. If set to {gb}, use gb-specific lookup rules. See {https://github.com/constabulary/gb} for details.",
+	"package-lookup-mode": "If set to {go}, use standard Go package lookup rules. If set to {gb}, use gb-specific lookup rules. See {https://github.com/constabulary/gb} for details. If set to {module}, use Go modules lookup rules: imports are resolved through the closest {go.mod} file, using the module cache, {replace} directives and the {vendor} directory. Modules used by the {go.work} file win over the module cache.",
 	"close-timeout":       "If there have been no completion requests after this number of seconds, the gocode process will terminate. Default is 30 minutes.",
-	"unimported-packages": "If set to {true}, gocode will try to import certain known packages automatically for identifiers which cannot be resolved otherwise. Currently only a limited set of standard library packages is supported.",
+	"unimported-packages": "If set to {true}, gocode will try to import packages automatically for identifiers which cannot be resolved otherwise. Packages are looked up in an index of GOROOT and GOPATH (or the current module and its dependencies) built in background, candidates carry the import to add as a text edit. Exported symbols of such packages are proposed for identifiers too: {json.Marshal} for {Marsh}.",
 	"partials":            "If set to {false}, gocode will not filter autocompletion results based on entered prefix before the cursor. Instead it will return all available autocompletion results viable for a given context. Whether this option is set to {true} or {false}, gocode will return a valid prefix length for output formats which support it. Setting this option to a non-default value may result in editor misbehaviour.",
 	"ignore-case":         "If set to {true}, gocode will perform case-insensitive matching when doing prefix-based filtering.",
 	"class-filtering":     "Enables or disables gocode's feature where it performs class-based filtering if partial input matches corresponding class keyword: const, var, type, func, package.",
+	"matcher":             "Defines how partial input is matched against autocompletion proposals. If set to {prefix}, proposals have to start with partial input. If set to {fuzzy}, partial input has to be a subsequence of a proposal, e.g. {nrw} matches {NewReadWriter}. If set to {camelcase}, partial input has to match beginnings of words of a proposal (camel case humps or underscore separated). For {fuzzy} and {camelcase} matchers proposals are ordered by relevance score, matching is always case-insensitive ({ignore-case} has no effect), the same case scores higher.",
+	"snippet-syntax":      "Defines the syntax of insert text for function proposals, which has a placeholder for each parameter, e.g. the insert text of {io.Copy} has placeholders for {dst} and {src}. If set to {lsp}, placeholders are escaped as LSP (TextMate) snippets expect. If set to {ultisnips}, as UltiSnips expects. If set to {none}, the insert text has no placeholders, just an opening parenthesis.",
+	"propose-all-cases":   "If set to {true}, gocode will propose all the remaining constants of the switch tag's type at once for the first expression of a case clause. The insert text adds a case clause per constant.",
+	"doc-comments":        "If set to {true}, gocode will attach doc comments to autocompletion proposals. Comments are kept for declarations parsed from source, for packages loaded from archives they are read from the package source directory when needed. Keeping the comments costs memory.",
 }
 
 var g_default_config = config{
@@ -61,6 +69,10 @@ var g_default_config = config{
 	Partials:           true,
 	IgnoreCase:         false,
 	ClassFiltering:     true,
+	Matcher:            "prefix",
+	SnippetSyntax:      "lsp",
+	ProposeAllCases:    false,
+	DocComments:        false,
 }
 var g_config = g_default_config
 
@@ -79,6 +91,25 @@ var g_string_to_bool = map[string]bool{
 	"0":     false,
 }
 
+// Values allowed for string options, others are ignored as invalid boolean
+// values are.
+var g_config_values = map[string][]string{
+	"matcher": {"prefix", "fuzzy", "camelcase"},
+}
+
+func valid_value(name, value string) bool {
+	values, ok := g_config_values[name]
+	if !ok {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func set_value(v reflect.Value, value string) {
 	switch t := v; t.Kind() {
 	case reflect.Bool:
@@ -145,7 +176,9 @@ func (this *config) set_option(name, value string) string {
 		v := str.Field(i)
 		nm := typ.Field(i).Tag.Get("json")
 		if nm == name {
-			set_value(v, value)
+			if valid_value(name, value) {
+				set_value(v, value)
+			}
 			list_value(v, name, buf)
 		}
 	}
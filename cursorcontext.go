@@ -15,6 +15,22 @@ type cursor_context struct {
 	struct_field bool
 	decl_import  bool
 
+	// goto, break or continue, if it's a label being completed
+	label token.Token
+
+	// fields of the struct literal which are set already
+	struct_keys map[string]bool
+
+	// named type of the switch tag and the values used by other case
+	// clauses, if it's a case expression being completed
+	switch_type  *decl
+	switch_cases map[string]bool
+	case_start   bool // the first expression of the case clause
+
+	// interface type of the type switch or the type assertion, if it's
+	// the asserted type being completed
+	assert_type *decl
+
 	// store expression that was supposed to be deduced to "decl", however
 	// if decl is nil, then deduction failed, we could try to resolve it to
 	// unimported package instead
@@ -108,63 +124,29 @@ func (this *token_iterator) skip_to_balanced_pair() bool {
 	return this.skip_to_left(left, right)
 }
 
-// Move the cursor to the open brace of the current block, taking nested blocks
-// into account.
-func (this *token_iterator) skip_to_left_curly() bool {
-	return this.skip_to_left(token.LBRACE, token.RBRACE)
-}
-
-func (ti *token_iterator) extract_type_alike() string {
-	if ti.token().tok != token.IDENT { // not Foo, return nothing
-		return ""
-	}
-	b := ti.token().literal()
-	if !ti.go_back() { // just Foo
-		return b
-	}
-	if ti.token().tok != token.PERIOD { // not .Foo, return Foo
-		return b
-	}
-	if !ti.go_back() { // just .Foo, return Foo (best choice recovery)
-		return b
-	}
-	if ti.token().tok != token.IDENT { // not lib.Foo, return Foo
-		return b
-	}
-	out := ti.token().literal() + "." + b // lib.Foo
-	ti.go_back()
-	return out
-}
-
-// Extract the type expression right before the enclosing curly bracket block.
-// Examples (# - the cursor):
-//   &lib.Struct{Whatever: 1, Hel#} // returns "lib.Struct"
-//   X{#}                           // returns X
-// The idea is that we check if this type expression is a type and it is, we
-// can apply special filtering for autocompletion results.
-// Sadly, this doesn't cover anonymous structs.
-func (ti *token_iterator) extract_struct_type() string {
-	if !ti.skip_to_left_curly() {
-		return ""
-	}
-	if !ti.go_back() {
-		return ""
-	}
-	if ti.token().tok == token.LBRACE { // Foo{#{}}
-		if !ti.go_back() {
-			return ""
+// Moves back to the '(' of the call the cursor is within the parentheses of,
+// skipping nested bracket pairs. Returns the number of arguments before the
+// cursor, false if the cursor is not within a call (or it's within a
+// composite literal or a function literal passed to a call).
+func (this *token_iterator) skip_to_call_lparen() (int, bool) {
+	index := 0
+	for {
+		switch this.token().tok {
+		case token.COMMA:
+			index++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if !this.skip_to_balanced_pair() {
+				return 0, false
+			}
+		case token.LPAREN:
+			return index, true
+		case token.LBRACK, token.LBRACE, token.SEMICOLON:
+			return 0, false
+		}
+		if !this.go_back() {
+			return 0, false
 		}
-	} else if ti.token().tok == token.COMMA { // Foo{abc,#{}}
-		return ti.extract_struct_type()
-	}
-	typ := ti.extract_type_alike()
-	if typ == "" {
-		return ""
-	}
-	if ti.token().tok == token.RPAREN || ti.token().tok == token.MUL {
-		return ""
 	}
-	return typ
 }
 
 // Starting from the token under the cursor move back and extract something
@@ -269,32 +251,285 @@ func (c *auto_complete_context) deduce_cursor_decl(iter *token_iterator) (*decl,
 	return expr_to_decl(expr, c.current.scope), expr
 }
 
-// try to find and extract the surrounding struct literal type
-func (c *auto_complete_context) deduce_struct_type_decl(iter *token_iterator) *decl {
-	typ := iter.extract_struct_type()
-	if typ == "" {
-		return nil
+// The iterator is at the '{' or ',' right before a field name of a struct
+// literal (or at least it looks like one). Returns the struct type and the
+// offset of the literal's '{'. Examples (# - the cursor):
+//
+//	&lib.Struct{Whatever: 1, Hel#} // lib.Struct
+//	Outer{Inner: Inner{#}}         // Inner
+//	[]Point{{X: 1}, {#}}           // Point
+//	map[string]Point{"a": {#}}     // Point
+func (c *auto_complete_context) deduce_struct_type_decl(iter *token_iterator) (*decl, int) {
+	for iter.token().tok != token.LBRACE {
+		switch iter.token().tok {
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if !iter.skip_to_balanced_pair() {
+				return nil, 0
+			}
+		case token.LPAREN, token.LBRACK, token.SEMICOLON:
+			// a call or an index expression within the literal
+			return nil, 0
+		}
+		if !iter.go_back() {
+			return nil, 0
+		}
 	}
+	lbrace := iter.token().off
 
-	expr, err := parser.ParseExpr(typ)
-	if err != nil {
-		return nil
+	t, s := c.deduce_composite_literal_type(iter)
+	if t == nil {
+		return nil, 0
 	}
-	decl := type_to_decl(expr, c.current.scope)
-	if decl == nil {
-		return nil
+	if st, ok := t.(*ast.StructType); ok {
+		// anonymous struct type
+		return new_decl_full("", decl_type, 0, st, nil, -1, s), lbrace
+	}
+	decl := type_to_decl(t, s)
+	if decl == nil || decl.class != decl_type {
+		return nil, 0
 	}
 
-	// we allow only struct types here, but also support type aliases
+	// we allow only struct types here, but also support type aliases and
+	// types defined by other struct types
+	sd := decl
 	if decl.is_alias() {
-		dd := decl.type_dealias()
-		if _, ok := dd.typ.(*ast.StructType); !ok {
-			return nil
+		sd = decl.type_dealias()
+		if sd == nil {
+			return nil, 0
+		}
+	}
+	sd = advance_to_struct_or_interface(sd)
+	if sd == nil {
+		return nil, 0
+	}
+	if _, ok := sd.typ.(*ast.StructType); !ok {
+		return nil, 0
+	}
+	return decl, lbrace
+}
+
+// Returns the field names which are already used as keys in the literal
+// starting at the '{' at the 'lbrace' offset, the one under the cursor
+// doesn't count.
+func struct_literal_keys(file []byte, lbrace, cursor int) map[string]bool {
+	keys := make(map[string]bool)
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	f := fset.AddFile("", fset.Base(), len(file)-lbrace)
+	s.Init(f, file[lbrace:], nil, 0)
+
+	depth := 0
+	var prev, key token_item
+	for {
+		pos, tok, lit := s.Scan()
+		off := lbrace + f.Offset(pos)
+		switch tok {
+		case token.EOF:
+			return keys
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+			if depth == 0 {
+				return keys
+			}
+		case token.COLON:
+			if depth == 1 && prev == key {
+				if cursor < key.off || cursor > key.off+len(key.lit) {
+					keys[key.lit] = true
+				}
+			}
+		case token.IDENT:
+			switch prev.tok {
+			case token.LBRACE, token.COMMA, token.SEMICOLON:
+				key = token_item{off, tok, lit}
+			}
+		}
+		prev = token_item{off, tok, lit}
+	}
+}
+
+// The iterator is at the token right before the operand under the cursor. If
+// the operand is an expression of a case clause and the switch tag has a
+// named type, returns the context proposing constants of that type. For type
+// switches, the context proposes types implementing the interface:
+//
+//	switch v { case A, #
+//	switch x := v.(type) { case #
+func (c *auto_complete_context) deduce_case_context(file []byte, cursor int, iter token_iterator, partial string) (cursor_context, bool) {
+	case_start := iter.token().tok == token.CASE
+	for iter.token().tok != token.CASE {
+		switch iter.token().tok {
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if !iter.skip_to_balanced_pair() {
+				return cursor_context{}, false
+			}
+		case token.LPAREN, token.LBRACK, token.LBRACE, token.COLON, token.SEMICOLON:
+			return cursor_context{}, false
+		}
+		if !iter.go_back() {
+			return cursor_context{}, false
+		}
+	}
+	if !iter.go_back() || !iter.skip_to_left(token.LBRACE, token.RBRACE) {
+		return cursor_context{}, false
+	}
+	lbrace := iter.token_index
+
+	// the tag is between the "switch" keyword (or the init statement) and
+	// the body, "select" is not interesting
+	tag := -1
+	for tag == -1 {
+		if !iter.go_back() {
+			return cursor_context{}, false
+		}
+		switch tok := iter.token().tok; tok {
+		case token.SWITCH:
+			tag = iter.token_index + 1
+		case token.SEMICOLON:
+			tag = iter.token_index + 1
+			for iter.token().tok != token.SWITCH {
+				if !iter.go_back() || iter.token().tok == token.SEMICOLON {
+					return cursor_context{}, false
+				}
+			}
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if !iter.skip_to_balanced_pair() {
+				return cursor_context{}, false
+			}
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			return cursor_context{}, false
+		case token.FUNC, token.MAP, token.CHAN, token.STRUCT, token.INTERFACE, token.TYPE:
+		default:
+			if tok.IsKeyword() {
+				return cursor_context{}, false
+			}
+		}
+	}
+	if tag == lbrace {
+		// switch { case x > 0:
+		return cursor_context{}, false
+	}
+	if lbrace-tag > 4 && iter.tokens[lbrace-2].tok == token.TYPE {
+		// x := v.(type)
+		iter.token_index = lbrace - 4
+		d := c.deduce_asserted_interface(&iter)
+		if d == nil {
+			return cursor_context{}, false
 		}
-	} else if _, ok := decl.typ.(*ast.StructType); !ok {
+		return cursor_context{
+			partial:      partial,
+			assert_type:  d,
+			switch_cases: case_clause_values(file, iter.tokens[lbrace].off, cursor),
+		}, true
+	}
+	expr, err := parser.ParseExpr(token_items_to_source(iter.tokens[tag:lbrace]))
+	if err != nil {
+		return cursor_context{}, false
+	}
+	t, s, is_type := infer_type(expr, c.current.scope, -1)
+	if t == nil || is_type {
+		return cursor_context{}, false
+	}
+	d := named_type_decl(t, s)
+	if d == nil {
+		return cursor_context{}, false
+	}
+	return cursor_context{
+		partial:      partial,
+		switch_type:  d,
+		switch_cases: case_clause_values(file, iter.tokens[lbrace].off, cursor),
+		case_start:   case_start,
+	}, true
+}
+
+// Returns the case expressions of the switch body starting at the '{' at the
+// 'lbrace' offset, the one under the cursor doesn't count. Expressions are
+// stored without spaces: "*os.File".
+func case_clause_values(file []byte, lbrace, cursor int) map[string]bool {
+	values := make(map[string]bool)
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	f := fset.AddFile("", fset.Base(), len(file)-lbrace)
+	s.Init(f, file[lbrace:], nil, 0)
+
+	depth := 0
+	in_case := false
+	var expr []token_item
+	for {
+		pos, tok, lit := s.Scan()
+		item := token_item{lbrace + f.Offset(pos), tok, lit}
+		switch tok {
+		case token.EOF:
+			return values
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+			if depth == 0 {
+				return values
+			}
+		case token.CASE:
+			if depth == 1 {
+				in_case = true
+				expr = expr[:0]
+				continue
+			}
+		case token.COMMA, token.COLON:
+			if !in_case || depth != 1 {
+				break
+			}
+			if len(expr) != 0 {
+				first, last := expr[0], expr[len(expr)-1]
+				if cursor < first.off || cursor > last.off+len(last.literal()) {
+					values[token_items_to_string(expr)] = true
+				}
+			}
+			in_case = tok == token.COMMA
+			expr = expr[:0]
+			continue
+		}
+		if in_case {
+			expr = append(expr, item)
+		}
+	}
+}
+
+// The iterator is at the '(' of a type assertion, returns the context
+// proposing types implementing the interface:
+//
+//	v.(#
+func (c *auto_complete_context) deduce_assertion_context(iter token_iterator, partial string) (cursor_context, bool) {
+	if !iter.go_back() || iter.token().tok != token.PERIOD {
+		return cursor_context{}, false
+	}
+	d := c.deduce_asserted_interface(&iter)
+	if d == nil {
+		return cursor_context{}, false
+	}
+	return cursor_context{partial: partial, assert_type: d}, true
+}
+
+// The iterator is at the '.' of a type assertion, returns the interface type
+// of the expression before it.
+func (c *auto_complete_context) deduce_asserted_interface(iter *token_iterator) *decl {
+	expr, err := parser.ParseExpr(iter.extract_go_expr())
+	if err != nil {
 		return nil
 	}
-	return decl
+	t, s, is_type := infer_type(expr, c.current.scope, -1)
+	if t == nil || is_type {
+		return nil
+	}
+	if it, ok := t.(*ast.InterfaceType); ok {
+		// anonymous interface type
+		return new_decl_full("", decl_type, 0, it, nil, -1, s)
+	}
+	d := type_to_decl(t, s)
+	if underlying_interface(d) == nil {
+		return nil
+	}
+	return d
 }
 
 // Entry point from autocompletion, the function looks at text before the cursor
@@ -386,197 +621,473 @@ func (c *auto_complete_context) deduce_cursor_context(file []byte, cursor int) (
 		case token.PERIOD:
 			decl, expr := c.deduce_cursor_decl(&iter)
 			return cursor_context{decl: decl, partial: partial, expr: expr}, decl != nil
-		case token.COMMA, token.LBRACE:
+		case token.GOTO, token.BREAK, token.CONTINUE:
+			return cursor_context{partial: partial, label: iter.token().tok}, true
+		case token.LPAREN:
+			if cc, ok := c.deduce_assertion_context(iter, partial); ok {
+				return cc, true
+			}
+			return cursor_context{partial: partial}, true
+		case token.CASE, token.COMMA, token.LBRACE:
+			if cc, ok := c.deduce_case_context(file, cursor, iter, partial); ok {
+				return cc, true
+			}
 			// This can happen for struct fields:
 			// &Struct{Hello: 1, Wor#} // (# - the cursor)
 			// Let's try to find the struct type
-			decl := c.deduce_struct_type_decl(&iter)
+			decl, lbrace := c.deduce_struct_type_decl(&iter)
+			if decl == nil {
+				return cursor_context{partial: partial}, true
+			}
 			return cursor_context{
 				decl:         decl,
 				partial:      partial,
-				struct_field: decl != nil,
+				struct_field: true,
+				struct_keys:  struct_literal_keys(file, lbrace, cursor),
 			}, true
 		default:
 			return cursor_context{partial: partial}, true
 		}
+	case token.GOTO, token.BREAK, token.CONTINUE:
+		// "goto #", but not "goto#"
+		if cursor > tok.off+len(tok.literal()) {
+			return cursor_context{label: tok.tok}, true
+		}
+	case token.LPAREN:
+		if cc, ok := c.deduce_assertion_context(iter, ""); ok {
+			return cc, true
+		}
+	case token.CASE:
+		// "case #", but not "case#"
+		if cursor > tok.off+len(tok.literal()) {
+			if cc, ok := c.deduce_case_context(file, cursor, iter, ""); ok {
+				return cc, true
+			}
+		}
 	case token.COMMA, token.LBRACE:
+		if cc, ok := c.deduce_case_context(file, cursor, iter, ""); ok {
+			return cc, true
+		}
 		// Try to parse the current expression as a structure initialization.
-		decl := c.deduce_struct_type_decl(&iter)
+		decl, lbrace := c.deduce_struct_type_decl(&iter)
+		if decl == nil {
+			return cursor_context{}, true
+		}
 		return cursor_context{
 			decl:         decl,
-			partial:      "",
-			struct_field: decl != nil,
+			struct_field: true,
+			struct_keys:  struct_literal_keys(file, lbrace, cursor),
 		}, true
 	}
 
 	return cursor_context{}, true
 }
 
-// Decl deduction failed, but we're on "<ident>.", this ident can be an
-// unexported package, let's try to match the ident against a set of known
-// packages and if it matches try to import it.
-// TODO: Right now I've made a static list of built-in packages, but in theory
-// we could scan all GOPATH packages as well. Now, don't forget that default
-// package name has nothing to do with package file name, that's why we need to
-// scan the packages. And many of them will have conflicts. Can we make a smart
-// prediction algorithm which will prefer certain packages over another ones?
-func resolveKnownPackageIdent(ident string, filename string, context *package_lookup_context) *package_file_cache {
-	importPath, ok := knownPackageIdents[ident]
-	if !ok {
-		return nil
+//-------------------------------------------------------------------------
+// expected type deduction
+//-------------------------------------------------------------------------
+
+// Figures out the type of the operand under the cursor by looking at the
+// code around it. Examples (# - the cursor):
+//
+//	x = #             // the type of x
+//	var x T = #       // T
+//	w.Write(#)        // []byte
+//	return a, #       // the second result of the enclosing function
+//	T{Field: #}       // the type of T.Field
+//	[]T{a, #}         // T
+func (c *auto_complete_context) deduce_expected_type(file []byte, cursor int) (ast.Expr, *scope) {
+	if cursor <= 0 {
+		return nil, nil
+	}
+	iter := new_token_iterator(file, cursor)
+	if len(iter.tokens) == 0 {
+		return nil, nil
 	}
 
-	path, ok := abs_path_for_package(filename, importPath, context)
+	// skip the operand itself, it's a partial identifier and/or a selector
+	// expression
+	if tok := iter.token(); tok.tok == token.IDENT {
+		if cursor-tok.off > len(tok.literal()) {
+			return nil, nil
+		}
+		if !iter.go_back() {
+			return nil, nil
+		}
+	}
+	if iter.token().tok == token.PERIOD {
+		iter.extract_go_expr()
+		if iter.token_index == 0 {
+			return nil, nil
+		}
+	}
+	return c.deduce_operand_type(&iter)
+}
+
+// The iterator is at the token right before the operand, the function moves
+// back to the beginning of the list the operand is part of and looks at
+// what the list belongs to.
+func (c *auto_complete_context) deduce_operand_type(iter *token_iterator) (ast.Expr, *scope) {
+	index := 0       // the number of operands before the operand
+	keyed := false   // the operand is a value of a "key: value" pair
+	key := ""        // and that's its key, if it's an identifier
+	haskeys := false // the operand is in a key position of a keyed list
+loop:
+	for {
+		switch tok := iter.token().tok; tok {
+		case token.COMMA:
+			index++
+		case token.COLON:
+			if keyed {
+				break
+			}
+			if index != 0 {
+				haskeys = true
+				break
+			}
+			keyed = true
+			if iter.token_index > 0 {
+				if prev := iter.tokens[iter.token_index-1]; prev.tok == token.IDENT {
+					key = prev.lit
+				}
+			}
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if !iter.skip_to_balanced_pair() {
+				return nil, nil
+			}
+		case token.LPAREN, token.LBRACE, token.RETURN, token.ASSIGN,
+			token.ADD_ASSIGN, token.SUB_ASSIGN, token.MUL_ASSIGN,
+			token.QUO_ASSIGN, token.REM_ASSIGN, token.AND_ASSIGN,
+			token.OR_ASSIGN, token.XOR_ASSIGN, token.AND_NOT_ASSIGN:
+			break loop
+		case token.FUNC, token.MAP, token.CHAN, token.STRUCT, token.INTERFACE:
+			// may be a part of a preceding operand
+		case token.SEMICOLON, token.DEFINE, token.LBRACK, token.ARROW,
+			token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+			token.SHL_ASSIGN, token.SHR_ASSIGN:
+			return nil, nil
+		default:
+			if tok.IsKeyword() {
+				return nil, nil
+			}
+		}
+		if !iter.go_back() {
+			return nil, nil
+		}
+	}
+
+	switch iter.token().tok {
+	case token.LBRACE:
+		return c.deduce_element_type(iter, index, keyed, key, haskeys)
+	case token.LPAREN:
+		if keyed || haskeys {
+			return nil, nil
+		}
+		return c.deduce_argument_type(iter, index)
+	case token.RETURN:
+		if keyed || haskeys || c.current.results == nil {
+			return nil, nil
+		}
+		ft := &ast.FuncType{Results: c.current.results}
+		return func_return_type(ft, index), c.current.results_scope
+	}
+	if keyed || haskeys {
+		return nil, nil
+	}
+	return c.deduce_assignment_type(iter, index)
+}
+
+// The iterator is at the '(' of a call or a conversion.
+func (c *auto_complete_context) deduce_argument_type(iter *token_iterator, index int) (ast.Expr, *scope) {
+	expr, err := parser.ParseExpr(iter.extract_go_expr())
+	if err != nil {
+		return nil, nil
+	}
+	t, s, is_type := infer_type(expr, c.current.scope, -1)
+	if t == nil {
+		return nil, nil
+	}
+	if is_type {
+		// T(#)
+		if index != 0 {
+			return nil, nil
+		}
+		return t, s
+	}
+
+	t, s = advance_to_type(func_predicate, t, s)
+	ft, ok := t.(*ast.FuncType)
+	if !ok || ft.TypeParams != nil {
+		return nil, nil
+	}
+	return func_param_type(ft, index), s
+}
+
+// The iterator is at the '=' (or an assignment operator) of an assignment
+// statement or a variable declaration.
+func (c *auto_complete_context) deduce_assignment_type(iter *token_iterator, index int) (ast.Expr, *scope) {
+	end := iter.token_index
+loop:
+	for iter.go_back() {
+		switch tok := iter.token().tok; tok {
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if !iter.skip_to_balanced_pair() {
+				return nil, nil
+			}
+		case token.SEMICOLON, token.LBRACE, token.LPAREN, token.COLON:
+			break loop
+		default:
+			if tok.IsKeyword() {
+				break loop
+			}
+		}
+	}
+	lhs := iter.tokens[iter.token_index+1 : end]
+
+	// var x, y T = #
+	is_var := iter.token().tok == token.VAR
+	if iter.token().tok == token.LPAREN && iter.go_back() {
+		is_var = iter.token().tok == token.VAR
+	}
+	if is_var {
+		decls, err := parse_decl_list(token.NewFileSet(), []byte("var "+token_items_to_source(lhs)))
+		if err != nil || len(decls) == 0 {
+			return nil, nil
+		}
+		spec := decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+		return spec.Type, c.current.scope
+	}
+
+	// x, y = #
+	var operands [][]token_item
+	depth, start := 0, 0
+	for i, t := range lhs {
+		switch t.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.COMMA:
+			if depth == 0 {
+				operands = append(operands, lhs[start:i])
+				start = i + 1
+			}
+		}
+	}
+	operands = append(operands, lhs[start:])
+	if index >= len(operands) {
+		return nil, nil
+	}
+	expr, err := parser.ParseExpr(token_items_to_source(operands[index]))
+	if err != nil {
+		return nil, nil
+	}
+	t, s, is_type := infer_type(expr, c.current.scope, -1)
+	if is_type {
+		return nil, nil
+	}
+	return t, s
+}
+
+// The iterator is at the '{' of a composite literal (or at least it looks
+// like one).
+func (c *auto_complete_context) deduce_element_type(iter *token_iterator, index int, keyed bool, key string, haskeys bool) (ast.Expr, *scope) {
+	t, s := c.deduce_composite_literal_type(iter)
+	if t == nil {
+		return nil, nil
+	}
+	t, s = advance_to_type(composite_predicate, t, s)
+	switch t := t.(type) {
+	case *ast.StructType:
+		if haskeys || keyed && key == "" {
+			return nil, nil
+		}
+		i := 0
+		for _, field := range t.Fields.List {
+			if field.Names == nil {
+				// embedded field, the name is the type name
+				if keyed && get_type_path(field.Type).name == key || !keyed && i == index {
+					return field.Type, s
+				}
+				i++
+				continue
+			}
+			for _, name := range field.Names {
+				if keyed && name.Name == key || !keyed && i == index {
+					return field.Type, s
+				}
+				i++
+			}
+		}
+	case *ast.ArrayType:
+		if haskeys {
+			return nil, nil
+		}
+		return t.Elt, s
+	case *ast.MapType:
+		if keyed {
+			return t.Value, s
+		}
+		return t.Key, s
+	}
+	return nil, nil
+}
+
+// The iterator is at the '{' of a composite literal. Returns the literal's
+// type, which is either right before the '{' or is elided in nested literals:
+//
+//	map[string]Point{"a": {#}} // Point
+func (c *auto_complete_context) deduce_composite_literal_type(iter *token_iterator) (ast.Expr, *scope) {
+	lbrace := iter.token_index
+	if !iter.go_back() {
+		return nil, nil
+	}
+	switch iter.token().tok {
+	case token.LBRACE, token.COMMA, token.COLON:
+		t, s := c.deduce_operand_type(iter)
+		if se, ok := t.(*ast.StarExpr); ok {
+			// []*Point{{#}}
+			return se.X, s
+		}
+		return t, s
+	}
+
+loop:
+	for {
+		switch iter.token().tok {
+		case token.IDENT, token.PERIOD, token.MAP, token.MUL, token.STRUCT:
+		case token.RBRACK:
+			if !iter.skip_to_balanced_pair() {
+				return nil, nil
+			}
+		case token.RBRACE:
+			// struct{...}{#}
+			if !iter.skip_to_balanced_pair() || !iter.go_back() || iter.token().tok != token.STRUCT {
+				return nil, nil
+			}
+		default:
+			break loop
+		}
+		if !iter.go_back() {
+			return nil, nil
+		}
+	}
+	if iter.token().tok == token.RPAREN {
+		// result type of a function: func() T {#}
+		return nil, nil
+	}
+	typ := iter.tokens[iter.token_index+1 : lbrace]
+	if len(typ) == 0 {
+		return nil, nil
+	}
+	expr, err := parser.ParseExpr(token_items_to_source(typ))
+	if err != nil {
+		return nil, nil
+	}
+	t, s, is_type := infer_type(expr, c.current.scope, -1)
+	if !is_type {
+		return nil, nil
+	}
+	return t, s
+}
+
+// Unlike token_items_to_string, separates tokens with spaces, which makes the
+// result parsable (e.g. "var x int").
+func token_items_to_source(tokens []token_item) string {
+	var buf bytes.Buffer
+	for i, t := range tokens {
+		if i != 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(t.literal())
+	}
+	return buf.String()
+}
+
+// Checks if the cursor is where a top-level declaration may start, which is
+// right after a semicolon outside of parentheses (partial input aside).
+func cursor_at_decl_start(file []byte, cursor int) bool {
+	iter := new_token_iterator(file, cursor)
+	if len(iter.tokens) == 0 {
+		return false
+	}
+	tok := iter.token()
+	if tok.tok == token.IDENT || tok.tok.IsKeyword() {
+		if cursor-tok.off > len(tok.literal()) {
+			return false
+		}
+		if !iter.go_back() {
+			return false
+		}
+	}
+	if iter.token().tok != token.SEMICOLON {
+		return false
+	}
+	depth := 0
+	for iter.go_back() {
+		switch iter.token().tok {
+		case token.RPAREN:
+			depth++
+		case token.LPAREN:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		}
+	}
+	return true
+}
+
+// Decl deduction failed, but we're on "<ident>.", this ident can be a package
+// which is not imported yet. Let's look it up in the package index, if there
+// are several packages with this name, the ones imported by other files of
+// the current package are preferred. Returns the package and its import path.
+func (c *auto_complete_context) resolve_unimported_package(ident string) (*package_file_cache, string) {
+	entries := g_daemon.pkgindex.lookup(ident, c.current.context.CurrentPackagePath)
+	if len(entries) == 0 {
+		return nil, ""
+	}
+	rank_packages(entries, c.imported_by_others())
+
+	for _, e := range entries {
+		if p := c.load_unimported_package(e); p != nil {
+			return p, e.path
+		}
+	}
+	return nil, ""
+}
+
+// Import paths of the packages imported by other files of the current
+// package.
+func (c *auto_complete_context) imported_by_others() map[string]bool {
+	imported := make(map[string]bool)
+	for _, f := range c.others {
+		for _, imp := range f.packages {
+			imported[imp.path] = true
+		}
+	}
+	return imported
+}
+
+func (c *auto_complete_context) load_unimported_package(e package_index_entry) *package_file_cache {
+	return c.load_package(e.path)
+}
+
+// Loads the package with the import path, whether the current file imports
+// it or not, nil if it's not found.
+func (c *auto_complete_context) load_package(import_path string) *package_file_cache {
+	path, ok := abs_path_for_package(c.current.name, import_path, c.current.context)
 	if !ok {
 		return nil
 	}
-
-	p := new_package_file_cache(path, importPath)
+	p, ok := c.pcache[path]
+	if !ok {
+		p = new_package_file_cache(path, import_path)
+	}
 	p.update_cache()
+	if p.main == nil {
+		return nil
+	}
+	c.pcache[p.name] = p
 	return p
 }
-
-var knownPackageIdents = map[string]string{
-	"adler32":         "hash/adler32",
-	"aes":             "crypto/aes",
-	"ascii85":         "encoding/ascii85",
-	"asn1":            "encoding/asn1",
-	"ast":             "go/ast",
-	"atomic":          "sync/atomic",
-	"base32":          "encoding/base32",
-	"base64":          "encoding/base64",
-	"big":             "math/big",
-	"binary":          "encoding/binary",
-	"bufio":           "bufio",
-	"build":           "go/build",
-	"bytes":           "bytes",
-	"bzip2":           "compress/bzip2",
-	"cgi":             "net/http/cgi",
-	"cgo":             "runtime/cgo",
-	"cipher":          "crypto/cipher",
-	"cmplx":           "math/cmplx",
-	"color":           "image/color",
-	"constant":        "go/constant",
-	"context":         "context",
-	"cookiejar":       "net/http/cookiejar",
-	"crc32":           "hash/crc32",
-	"crc64":           "hash/crc64",
-	"crypto":          "crypto",
-	"csv":             "encoding/csv",
-	"debug":           "runtime/debug",
-	"des":             "crypto/des",
-	"doc":             "go/doc",
-	"draw":            "image/draw",
-	"driver":          "database/sql/driver",
-	"dsa":             "crypto/dsa",
-	"dwarf":           "debug/dwarf",
-	"ecdsa":           "crypto/ecdsa",
-	"elf":             "debug/elf",
-	"elliptic":        "crypto/elliptic",
-	"encoding":        "encoding",
-	"errors":          "errors",
-	"exec":            "os/exec",
-	"expvar":          "expvar",
-	"fcgi":            "net/http/fcgi",
-	"filepath":        "path/filepath",
-	"flag":            "flag",
-	"flate":           "compress/flate",
-	"fmt":             "fmt",
-	"fnv":             "hash/fnv",
-	"format":          "go/format",
-	"gif":             "image/gif",
-	"gob":             "encoding/gob",
-	"gosym":           "debug/gosym",
-	"gzip":            "compress/gzip",
-	"hash":            "hash",
-	"heap":            "container/heap",
-	"hex":             "encoding/hex",
-	"hmac":            "crypto/hmac",
-	"hpack":           "vendor/golang_org/x/net/http2/hpack",
-	"html":            "html",
-	"http":            "net/http",
-	"httplex":         "vendor/golang_org/x/net/lex/httplex",
-	"httptest":        "net/http/httptest",
-	"httptrace":       "net/http/httptrace",
-	"httputil":        "net/http/httputil",
-	"image":           "image",
-	"importer":        "go/importer",
-	"io":              "io",
-	"iotest":          "testing/iotest",
-	"ioutil":          "io/ioutil",
-	"jpeg":            "image/jpeg",
-	"json":            "encoding/json",
-	"jsonrpc":         "net/rpc/jsonrpc",
-	"list":            "container/list",
-	"log":             "log",
-	"lzw":             "compress/lzw",
-	"macho":           "debug/macho",
-	"mail":            "net/mail",
-	"math":            "math",
-	"md5":             "crypto/md5",
-	"mime":            "mime",
-	"multipart":       "mime/multipart",
-	"net":             "net",
-	"os":              "os",
-	"palette":         "image/color/palette",
-	"parse":           "text/template/parse",
-	"parser":          "go/parser",
-	"path":            "path",
-	"pe":              "debug/pe",
-	"pem":             "encoding/pem",
-	"pkix":            "crypto/x509/pkix",
-	"plan9obj":        "debug/plan9obj",
-	"png":             "image/png",
-	"pprof":           "net/http/pprof",
-	"printer":         "go/printer",
-	"quick":           "testing/quick",
-	"quotedprintable": "mime/quotedprintable",
-	"race":            "runtime/race",
-	"rand":            "math/rand",
-	"rc4":             "crypto/rc4",
-	"reflect":         "reflect",
-	"regexp":          "regexp",
-	"ring":            "container/ring",
-	"rpc":             "net/rpc",
-	"rsa":             "crypto/rsa",
-	"runtime":         "runtime",
-	"scanner":         "text/scanner",
-	"sha1":            "crypto/sha1",
-	"sha256":          "crypto/sha256",
-	"sha512":          "crypto/sha512",
-	"signal":          "os/signal",
-	"smtp":            "net/smtp",
-	"sort":            "sort",
-	"sql":             "database/sql",
-	"strconv":         "strconv",
-	"strings":         "strings",
-	"subtle":          "crypto/subtle",
-	"suffixarray":     "index/suffixarray",
-	"sync":            "sync",
-	"syntax":          "regexp/syntax",
-	"syscall":         "syscall",
-	"syslog":          "log/syslog",
-	"tabwriter":       "text/tabwriter",
-	"tar":             "archive/tar",
-	"template":        "html/template",
-	"testing":         "testing",
-	"textproto":       "net/textproto",
-	"time":            "time",
-	"tls":             "crypto/tls",
-	"token":           "go/token",
-	"trace":           "runtime/trace",
-	"types":           "go/types",
-	"unicode":         "unicode",
-	"url":             "net/url",
-	"user":            "os/user",
-	"utf16":           "unicode/utf16",
-	"utf8":            "unicode/utf8",
-	"x509":            "crypto/x509",
-	"xml":             "encoding/xml",
-	"zip":             "archive/zip",
-	"zlib":            "compress/zlib",
-	//"scanner": "go/scanner", // DUP: prefer text/scanner
-	//"template": "text/template", // DUP: prefer html/template
-	//"pprof": "runtime/pprof", // DUP: prefer net/http/pprof
-	//"rand": "crypto/rand", // DUP: prefer math/rand
-}
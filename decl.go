@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"io"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -21,6 +23,8 @@ const (
 	decl_const
 	decl_func
 	decl_import
+	decl_keyword
+	decl_label
 	decl_package
 	decl_type
 	decl_var
@@ -40,6 +44,10 @@ func (this decl_class) String() string {
 		return "func"
 	case decl_import:
 		return "import"
+	case decl_keyword:
+		return "keyword"
+	case decl_label:
+		return "label"
 	case decl_package:
 		return "package"
 	case decl_type:
@@ -65,6 +73,17 @@ const (
 	// decl of decl_type class is a type alias
 	decl_alias
 
+	// decl of decl_type class is a type parameter bound to a type argument
+	// of an instantiated generic type or function, always goes together with
+	// decl_alias
+	decl_typeparam
+
+	// the doc comment has a "Deprecated: " paragraph
+	decl_deprecated
+
+	// decl of decl_func class is a method with a pointer receiver
+	decl_ptrrecv
+
 	// for preventing infinite recursions and loops in type inference code
 	decl_visited
 )
@@ -91,6 +110,10 @@ type decl struct {
 	// embedded types
 	embedded []ast.Expr
 
+	// type parameters of a generic type, for methods of a generic type these
+	// are the receiver type parameters (names only)
+	tparams *ast.FieldList
+
 	// if the type is unknown at AST building time, I'm using these
 	value ast.Expr
 
@@ -101,6 +124,15 @@ type decl struct {
 	// scope where this Decl was declared in (not its visibilty scope!)
 	// Decl uses it for type inference
 	scope *scope
+
+	// doc comment, see the "doc-comments" config option
+	doc string
+
+	// where the declaration is, the zero position if it's unknown
+	pos token.Position
+
+	// value expression of a constant, iota is replaced by its value already
+	const_value ast.Expr
 }
 
 func ast_decl_type(d ast.Decl) ast.Expr {
@@ -120,6 +152,37 @@ func ast_decl_type(d ast.Decl) ast.Expr {
 	panic("unreachable")
 }
 
+// Returns the doc comment of the declaration (or the line comment if there is
+// none).
+func ast_decl_doc(d ast.Decl) string {
+	var doc, comment *ast.CommentGroup
+	switch t := d.(type) {
+	case *ast.GenDecl:
+		switch s := t.Specs[0].(type) {
+		case *ast.ValueSpec:
+			doc, comment = s.Doc, s.Comment
+		case *ast.TypeSpec:
+			doc, comment = s.Doc, s.Comment
+		}
+		if doc == nil && !t.Lparen.IsValid() {
+			doc = t.Doc
+		}
+	case *ast.FuncDecl:
+		doc = t.Doc
+	}
+	if doc == nil {
+		doc = comment
+	}
+	return doc.Text()
+}
+
+func ast_field_doc(f *ast.Field) string {
+	if f.Doc != nil {
+		return f.Doc.Text()
+	}
+	return f.Comment.Text()
+}
+
 func ast_decl_flags(d ast.Decl) decl_flags {
 	switch t := d.(type) {
 	case *ast.GenDecl:
@@ -129,6 +192,12 @@ func ast_decl_flags(d ast.Decl) decl_flags {
 				return decl_alias
 			}
 		}
+	case *ast.FuncDecl:
+		if t.Recv != nil && len(t.Recv.List) != 0 {
+			if _, ok := t.Recv.List[0].Type.(*ast.StarExpr); ok {
+				return decl_ptrrecv
+			}
+		}
 	}
 	return 0
 }
@@ -183,6 +252,8 @@ func ast_field_list_to_decls(f *ast.FieldList, class decl_class, flags decl_flag
 				scope:       scope,
 				value_index: -1,
 			}
+			d.set_doc(ast_field_doc(field))
+			d.set_pos(name.Pos())
 			decls[d.name] = d
 		}
 
@@ -200,6 +271,8 @@ func ast_field_list_to_decls(f *ast.FieldList, class decl_class, flags decl_flag
 				scope:       scope,
 				value_index: -1,
 			}
+			d.set_doc(ast_field_doc(field))
+			d.set_pos(field.Type.Pos())
 			decls[d.name] = d
 		}
 	}
@@ -340,13 +413,13 @@ func new_decl_var(name string, typ ast.Expr, value ast.Expr, vindex int, scope *
 func method_of(d ast.Decl) string {
 	if t, ok := d.(*ast.FuncDecl); ok {
 		if t.Recv != nil && len(t.Recv.List) != 0 {
-			switch t := t.Recv.List[0].Type.(type) {
+			switch t := strip_type_args(t.Recv.List[0].Type).(type) {
 			case *ast.StarExpr:
-				if se, ok := t.X.(*ast.SelectorExpr); ok {
-					return se.Sel.Name
-				}
-				if ident, ok := t.X.(*ast.Ident); ok {
-					return ident.Name
+				switch x := strip_type_args(t.X).(type) {
+				case *ast.SelectorExpr:
+					return x.Sel.Name
+				case *ast.Ident:
+					return x.Name
 				}
 				return ""
 			case *ast.Ident:
@@ -359,6 +432,36 @@ func method_of(d ast.Decl) string {
 	return ""
 }
 
+// ast_decl_type_params returns type parameters of a generic type declaration
+// or receiver type parameters of a method of a generic type, for the latter
+// only names are known
+func ast_decl_type_params(d ast.Decl) *ast.FieldList {
+	switch t := d.(type) {
+	case *ast.GenDecl:
+		if t.Tok == token.TYPE {
+			return t.Specs[0].(*ast.TypeSpec).TypeParams
+		}
+	case *ast.FuncDecl:
+		if t.Recv == nil || len(t.Recv.List) == 0 {
+			return nil
+		}
+		args := type_args(t.Recv.List[0].Type)
+		if args == nil {
+			return nil
+		}
+		names := make([]*ast.Ident, 0, len(args))
+		for _, a := range args {
+			if ident, ok := a.(*ast.Ident); ok {
+				names = append(names, ident)
+			} else {
+				names = append(names, ast.NewIdent("_"))
+			}
+		}
+		return &ast.FieldList{List: []*ast.Field{{Names: names}}}
+	}
+	return nil
+}
+
 func (other *decl) deep_copy() *decl {
 	d := new(decl)
 	d.name = other.name
@@ -375,10 +478,33 @@ func (other *decl) deep_copy() *decl {
 		d.embedded = make([]ast.Expr, len(other.embedded))
 		copy(d.embedded, other.embedded)
 	}
+	d.tparams = other.tparams
 	d.scope = other.scope
+	d.doc = other.doc
+	d.pos = other.pos
+	d.const_value = other.const_value
 	return d
 }
 
+// Records the doc comment of the declaration, the text is kept only if the
+// "doc-comments" config option is set.
+func (d *decl) set_doc(doc string) {
+	if strings.HasPrefix(doc, "Deprecated: ") || strings.Contains(doc, "\n\nDeprecated: ") {
+		d.flags |= decl_deprecated
+	}
+	if g_config.DocComments {
+		d.doc = doc
+	}
+}
+
+// Records the position of the declaration, 'p' is resolved by the scope the
+// declaration was made in.
+func (d *decl) set_pos(p token.Pos) {
+	if d.scope != nil {
+		d.pos = d.scope.position_of(p)
+	}
+}
+
 func (d *decl) is_rangevar() bool {
 	return d.flags&decl_rangevar != 0
 }
@@ -409,6 +535,9 @@ func (d *decl) expand_or_replace(other *decl) {
 		d.typ = other.typ
 		d.class = other.class
 		d.flags = other.flags
+		d.tparams = other.tparams
+		d.doc = other.doc
+		d.pos = other.pos
 	}
 
 	if other.children != nil {
@@ -431,9 +560,12 @@ func (d *decl) matches() bool {
 }
 
 func (d *decl) pretty_print_type(out io.Writer, canonical_aliases map[string]string) {
+	// children of instantiated generic types are printed with type
+	// arguments in place of type parameters
+	typ := subst_type_params(d.typ, d.scope)
 	switch d.class {
 	case decl_type:
-		switch d.typ.(type) {
+		switch typ.(type) {
 		case *ast.StructType:
 			// TODO: not used due to anonymify?
 			fmt.Fprintf(out, "struct")
@@ -441,16 +573,16 @@ func (d *decl) pretty_print_type(out io.Writer, canonical_aliases map[string]str
 			// TODO: not used due to anonymify?
 			fmt.Fprintf(out, "interface")
 		default:
-			if d.typ != nil {
-				pretty_print_type_expr(out, d.typ, canonical_aliases)
+			if typ != nil {
+				pretty_print_type_expr(out, typ, canonical_aliases)
 			}
 		}
 	case decl_var:
-		if d.typ != nil {
-			pretty_print_type_expr(out, d.typ, canonical_aliases)
+		if typ != nil {
+			pretty_print_type_expr(out, typ, canonical_aliases)
 		}
 	case decl_func:
-		pretty_print_type_expr(out, d.typ, canonical_aliases)
+		pretty_print_type_expr(out, typ, canonical_aliases)
 	}
 }
 
@@ -525,6 +657,31 @@ func func_return_type(f *ast.FuncType, index int) ast.Expr {
 	return nil
 }
 
+// Returns the type of the parameter an argument at 'index' is passed to,
+// arguments past the end go to the variadic parameter (if there is one).
+func func_param_type(f *ast.FuncType, index int) ast.Expr {
+	if f.Params == nil {
+		return nil
+	}
+
+	i := 0
+	for _, field := range f.Params.List {
+		if e, ok := field.Type.(*ast.Ellipsis); ok {
+			// variadic parameter is always the last one
+			return e.Elt
+		}
+		n := 1
+		if field.Names != nil {
+			n = len(field.Names)
+		}
+		if index < i+n {
+			return field.Type
+		}
+		i += n
+	}
+	return nil
+}
+
 type type_path struct {
 	pkg  string
 	name string
@@ -554,6 +711,10 @@ func get_type_path(e ast.Expr) (r type_path) {
 			r.pkg = ident.Name
 		}
 		r.name = t.Sel.Name
+	case *ast.IndexExpr:
+		r = get_type_path(t.X)
+	case *ast.IndexListExpr:
+		r = get_type_path(t.X)
 	}
 	return
 }
@@ -604,6 +765,12 @@ func type_to_decl(t ast.Expr, scope *scope) *decl {
 		// weird variable declaration pointing to itself
 		return nil
 	}
+	if d != nil && d.tparams != nil && d.class == decl_type {
+		// Set[int] or *Cache[string, *User]
+		if args := type_args(t); args != nil {
+			return d.instantiate(args, scope)
+		}
+	}
 	return d
 }
 
@@ -676,6 +843,25 @@ func index_predicate(v ast.Expr) bool {
 	return false
 }
 
+func composite_predicate(v ast.Expr) bool {
+	switch v.(type) {
+	case *ast.StructType, *ast.ArrayType, *ast.MapType:
+		return true
+	}
+	return false
+}
+
+// Types with a nil value.
+func nilable_predicate(v ast.Expr) bool {
+	switch t := v.(type) {
+	case *ast.ArrayType:
+		return t.Len == nil
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return true
+	}
+	return false
+}
+
 func star_predicate(v ast.Expr) bool {
 	_, ok := v.(*ast.StarExpr)
 	return ok
@@ -825,10 +1011,19 @@ func infer_type(v ast.Expr, scope *scope, index int) (ast.Expr, *scope, bool) {
 		}
 	case *ast.IndexExpr:
 		// something[another] always returns a value and it works on a value too
-		it, s, _ := infer_type(t.X, scope, -1)
+		it, s, is_type := infer_type(t.X, scope, -1)
 		if it == nil {
 			break
 		}
+		if is_type {
+			// generic type instantiation: Set[int]
+			return t, scope, true
+		}
+		if ft, ok := it.(*ast.FuncType); ok && ft.TypeParams != nil {
+			// generic function instantiation: NewSet[int]
+			ft, s = instantiate_func_type(ft, s, []ast.Expr{t.Index}, scope)
+			return ft, s, false
+		}
 		it, s = advance_to_type(index_predicate, it, s)
 		switch t := it.(type) {
 		case *ast.ArrayType:
@@ -843,6 +1038,20 @@ func infer_type(v ast.Expr, scope *scope, index int) (ast.Expr, *scope, bool) {
 				return ast.NewIdent("bool"), g_universe_scope, false
 			}
 		}
+	case *ast.IndexListExpr:
+		// the same as above, but with multiple type arguments:
+		// Cache[string, *User] or NewCache[string, *User]
+		it, s, is_type := infer_type(t.X, scope, -1)
+		if it == nil {
+			break
+		}
+		if is_type {
+			return t, scope, true
+		}
+		if ft, ok := it.(*ast.FuncType); ok && ft.TypeParams != nil {
+			ft, s = instantiate_func_type(ft, s, t.Indices, scope)
+			return ft, s, false
+		}
 	case *ast.SliceExpr:
 		// something[start : end] always returns a value
 		it, s, _ := infer_type(t.X, scope, -1)
@@ -894,8 +1103,13 @@ func infer_type(v ast.Expr, scope *scope, index int) (ast.Expr, *scope, bool) {
 			}
 
 			// then check for an ordinary function call
-			it, scope = advance_to_type(func_predicate, it, s)
+			it, _ = advance_to_type(func_predicate, it, s)
 			if ct, ok := it.(*ast.FuncType); ok {
+				if ct.TypeParams != nil {
+					// generic function call without explicit type
+					// arguments, try to infer them
+					ct, s = infer_func_type_args(ct, s, t.Args, scope)
+				}
 				return func_return_type(ct, index), s, false
 			}
 		}
@@ -964,6 +1178,10 @@ func (d *decl) infer_type() (ast.Expr, *scope) {
 		// package is handled specially in inferType
 		return nil, nil
 	case decl_type:
+		if d.flags&decl_typeparam != 0 {
+			// bound type parameter, the type argument is the type
+			return d.typ, d.scope
+		}
 		return ast.NewIdent(d.name), d.scope
 	}
 
@@ -979,8 +1197,15 @@ func (d *decl) infer_type() (ast.Expr, *scope) {
 	d.set_visited()
 	defer d.clear_visited()
 
+	// constants keep their values separately, the type of the value is
+	// the type of an untyped constant, e.g. const Timeout = 3 * time.Second
+	value, index := d.value, d.value_index
+	if value == nil && d.const_value != nil {
+		value, index = d.const_value, -1
+	}
+
 	var scope *scope
-	d.typ, scope, _ = infer_type(d.value, d.scope, d.value_index)
+	d.typ, scope, _ = infer_type(value, d.scope, index)
 	return d.typ, scope
 }
 
@@ -1062,6 +1287,72 @@ func (d *decl) find_child_and_in_embedded(name string) *decl {
 	return c
 }
 
+// Returns the interface type 'd' stands for, aliases and defined types
+// aside, or nil if it's not an interface type.
+func underlying_interface(d *decl) *decl {
+	if d == nil || d.class != decl_type {
+		return nil
+	}
+	if d.is_alias() {
+		if d = d.type_dealias(); d == nil {
+			return nil
+		}
+	}
+	if d = advance_to_struct_or_interface(d); d == nil {
+		return nil
+	}
+	if _, ok := d.typ.(*ast.InterfaceType); !ok {
+		return nil
+	}
+	return d
+}
+
+// Adds the methods of the interface type to 'methods', including the ones of
+// embedded interfaces.
+func (d *decl) interface_methods(methods map[string]*decl) {
+	if d.is_visited() {
+		return
+	}
+	d.set_visited()
+	defer d.clear_visited()
+
+	for _, c := range d.children {
+		if c.class == decl_func {
+			methods[c.name] = c
+		}
+	}
+	for _, e := range d.embedded {
+		if ed := underlying_interface(type_to_decl(e, d.scope)); ed != nil {
+			ed.interface_methods(methods)
+		}
+	}
+}
+
+// Checks if the type has all the 'methods', its own or promoted from
+// embedded types. Methods are compared by names and numbers of parameters
+// and results. 'ptr' is set if some of them have pointer receivers, only the
+// pointer type has all of them then.
+func (d *decl) has_methods(methods map[string]*decl) (ok, ptr bool) {
+	for name, m := range methods {
+		c := d.find_child_and_in_embedded(name)
+		if c == nil || c.class != decl_func {
+			return false, false
+		}
+		if c.flags&decl_ptrrecv != 0 {
+			ptr = true
+		}
+		ct, ok1 := c.typ.(*ast.FuncType)
+		mt, ok2 := m.typ.(*ast.FuncType)
+		if !ok1 || !ok2 {
+			continue
+		}
+		if ct.Params.NumFields() != mt.Params.NumFields() || ct.Results.NumFields() != mt.Results.NumFields() {
+			return false, false
+		}
+	}
+	return true, ptr
+}
+
 // Special type inference for range statements.
 // [int], [int] := range [string]
 // [int], [value] := range [slice or array]
@@ -1115,6 +1406,440 @@ func infer_range_type(e ast.Expr, sc *scope, valueindex int) (ast.Expr, *scope)
 	return nil, nil
 }
 
+//-------------------------------------------------------------------------
+// Generics
+//
+// Type parameters are handled via instantiation scopes. When a generic type
+// or function is instantiated, a new scope is created on top of its
+// declaration scope, in that scope each type parameter is a type alias which
+// points to the corresponding type argument (in the scope of the type
+// argument). This way the rest of the type inference code resolves type
+// parameters just like any other alias.
+//-------------------------------------------------------------------------
+
+// returns type arguments of an instantiated type expression, e.g. [int] for
+// *Set[int] or [string, *User] for Cache[string, *User]
+func type_args(e ast.Expr) []ast.Expr {
+	switch t := e.(type) {
+	case *ast.StarExpr:
+		return type_args(t.X)
+	case *ast.ParenExpr:
+		return type_args(t.X)
+	case *ast.IndexExpr:
+		return []ast.Expr{t.Index}
+	case *ast.IndexListExpr:
+		return t.Indices
+	}
+	return nil
+}
+
+// strips type arguments from an instantiated type expression: Set[int] -> Set
+func strip_type_args(e ast.Expr) ast.Expr {
+	switch t := e.(type) {
+	case *ast.IndexExpr:
+		return t.X
+	case *ast.IndexListExpr:
+		return t.X
+	}
+	return e
+}
+
+func new_decl_type_param(name string, typ ast.Expr, s *scope) *decl {
+	d := new_decl(name, decl_type, s)
+	d.flags = decl_alias | decl_typeparam
+	d.typ = typ
+	return d
+}
+
+// Creates an instantiation scope on top of 'parent' which binds type
+// parameters 'tparams' to type arguments 'args', the latter make sense in
+// the scope 's'.
+func bind_type_params(parent *scope, tparams *ast.FieldList, args []ast.Expr, s *scope) *scope {
+	inst := new_scope(parent)
+	i := 0
+	for _, field := range tparams.List {
+		for _, name := range field.Names {
+			if i >= len(args) {
+				return inst
+			}
+			if name.Name != "_" {
+				inst.add_named_decl(new_decl_type_param(name.Name, args[i], s))
+			}
+			i++
+		}
+	}
+	return inst
+}
+
+func is_instantiation_scope(s *scope) bool {
+	for _, d := range s.entities {
+		return d != nil && d.flags&decl_typeparam != 0
+	}
+	return false
+}
+
+// Returns a copy of a generic type declaration with its type parameters bound
+// to 'args'. Children are copied as well, because they need to see the
+// instantiation scope for type inference and pretty printing.
+func (d *decl) instantiate(args []ast.Expr, s *scope) *decl {
+	inst := d.deep_copy()
+	inst.tparams = nil
+	inst.scope = bind_type_params(d.scope, d.tparams, args, s)
+	for name, c := range d.children {
+		tparams := d.tparams
+		if c.tparams != nil {
+			// methods may use different names for receiver type parameters
+			tparams = c.tparams
+		}
+		cc := new(decl)
+		*cc = *c
+		cc.tparams = nil
+		cc.scope = bind_type_params(c.scope, tparams, args, s)
+		inst.children[name] = cc
+	}
+	return inst
+}
+
+// Explicit instantiation of a generic function: Map[int, string].
+func instantiate_func_type(f *ast.FuncType, fs *scope, args []ast.Expr, s *scope) (*ast.FuncType, *scope) {
+	return &ast.FuncType{Params: f.Params, Results: f.Results}, bind_type_params(fs, f.TypeParams, args, s)
+}
+
+// Implicit instantiation of a generic function: Map(xs, f). Type arguments
+// are inferred from the types of the call arguments. Only simple cases are
+// supported, where the type parameter appears directly in the parameter type
+// or in a pointer, slice, map, chan or func type built from it.
+func infer_func_type_args(f *ast.FuncType, fs *scope, args []ast.Expr, s *scope) (*ast.FuncType, *scope) {
+	tparams := make(map[string]bool)
+	for _, field := range f.TypeParams.List {
+		for _, name := range field.Names {
+			tparams[name.Name] = true
+		}
+	}
+
+	ptypes := field_list_types(f.Params)
+	bound := make(map[string]*decl)
+	for i, arg := range args {
+		if len(ptypes) == 0 {
+			break
+		}
+		var ptyp ast.Expr
+		if i < len(ptypes) {
+			ptyp = ptypes[i]
+		} else {
+			// variadic tail
+			ptyp = ptypes[len(ptypes)-1]
+		}
+		if e, ok := ptyp.(*ast.Ellipsis); ok {
+			ptyp = e.Elt
+		}
+		atyp, ascope, _ := infer_type(arg, s, -1)
+		if atyp == nil {
+			continue
+		}
+		unify_type_params(ptyp, atyp, ascope, tparams, bound)
+	}
+
+	inst := new_scope(fs)
+	for _, d := range bound {
+		inst.add_named_decl(d)
+	}
+	return &ast.FuncType{Params: f.Params, Results: f.Results}, inst
+}
+
+func unify_type_params(p, a ast.Expr, s *scope, tparams map[string]bool, bound map[string]*decl) {
+	switch pt := p.(type) {
+	case *ast.Ident:
+		if tparams[pt.Name] && bound[pt.Name] == nil {
+			bound[pt.Name] = new_decl_type_param(pt.Name, a, s)
+		}
+	case *ast.StarExpr:
+		if at, ok := a.(*ast.StarExpr); ok {
+			unify_type_params(pt.X, at.X, s, tparams, bound)
+		}
+	case *ast.ArrayType:
+		switch at := a.(type) {
+		case *ast.ArrayType:
+			unify_type_params(pt.Elt, at.Elt, s, tparams, bound)
+		case *ast.Ellipsis:
+			unify_type_params(pt.Elt, at.Elt, s, tparams, bound)
+		}
+	case *ast.MapType:
+		if at, ok := a.(*ast.MapType); ok {
+			unify_type_params(pt.Key, at.Key, s, tparams, bound)
+			unify_type_params(pt.Value, at.Value, s, tparams, bound)
+		}
+	case *ast.ChanType:
+		if at, ok := a.(*ast.ChanType); ok {
+			unify_type_params(pt.Value, at.Value, s, tparams, bound)
+		}
+	case *ast.FuncType:
+		if at, ok := a.(*ast.FuncType); ok {
+			unify_field_lists(pt.Params, at.Params, s, tparams, bound)
+			unify_field_lists(pt.Results, at.Results, s, tparams, bound)
+		}
+	}
+}
+
+func unify_field_lists(p, a *ast.FieldList, s *scope, tparams map[string]bool, bound map[string]*decl) {
+	ptypes, atypes := field_list_types(p), field_list_types(a)
+	for i := 0; i < len(ptypes) && i < len(atypes); i++ {
+		unify_type_params(ptypes[i], atypes[i], s, tparams, bound)
+	}
+}
+
+// flattens a field list into a list of types, one per name
+func field_list_types(f *ast.FieldList) []ast.Expr {
+	if f == nil {
+		return nil
+	}
+	var types []ast.Expr
+	for _, field := range f.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, field.Type)
+		}
+	}
+	return types
+}
+
+// Replaces type parameters bound in the instantiation scope 's' with their
+// type arguments. The result is meant to be used for pretty printing only,
+// type arguments and the rest of the expression make sense in different
+// scopes.
+func subst_type_params(e ast.Expr, s *scope) ast.Expr {
+	if e == nil || s == nil || !is_instantiation_scope(s) {
+		return e
+	}
+
+	switch t := e.(type) {
+	case *ast.Ident:
+		d, ok := s.entities[t.Name]
+		if !ok || d.flags&decl_typeparam == 0 || d.is_visited() {
+			return e
+		}
+		d.set_visited()
+		defer d.clear_visited()
+		return subst_type_params(d.typ, d.scope)
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: subst_type_params(t.X, s)}
+	case *ast.ParenExpr:
+		return &ast.ParenExpr{X: subst_type_params(t.X, s)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: t.Len, Elt: subst_type_params(t.Elt, s)}
+	case *ast.Ellipsis:
+		return &ast.Ellipsis{Elt: subst_type_params(t.Elt, s)}
+	case *ast.MapType:
+		return &ast.MapType{
+			Key:   subst_type_params(t.Key, s),
+			Value: subst_type_params(t.Value, s),
+		}
+	case *ast.ChanType:
+		return &ast.ChanType{Dir: t.Dir, Value: subst_type_params(t.Value, s)}
+	case *ast.FuncType:
+		return &ast.FuncType{
+			TypeParams: t.TypeParams,
+			Params:     subst_field_list_type_params(t.Params, s),
+			Results:    subst_field_list_type_params(t.Results, s),
+		}
+	case *ast.IndexExpr:
+		return &ast.IndexExpr{X: t.X, Index: subst_type_params(t.Index, s)}
+	case *ast.IndexListExpr:
+		indices := make([]ast.Expr, len(t.Indices))
+		for i, index := range t.Indices {
+			indices[i] = subst_type_params(index, s)
+		}
+		return &ast.IndexListExpr{X: t.X, Indices: indices}
+	}
+	return e
+}
+
+func subst_field_list_type_params(f *ast.FieldList, s *scope) *ast.FieldList {
+	if f == nil {
+		return nil
+	}
+	out := &ast.FieldList{List: make([]*ast.Field, len(f.List))}
+	for i, field := range f.List {
+		out.List[i] = &ast.Field{
+			Names: field.Names,
+			Type:  subst_type_params(field.Type, s),
+		}
+	}
+	return out
+}
+
+//-------------------------------------------------------------------------
+// Constant values
+//-------------------------------------------------------------------------
+
+// Returns a copy of the constant expression 'e' with iota replaced by its
+// value, implicitly repeated expressions are shared between constants.
+func subst_iota(e ast.Expr, iota int) ast.Expr {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if t.Name == "iota" {
+			return &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(iota)}
+		}
+	case *ast.ParenExpr:
+		return &ast.ParenExpr{X: subst_iota(t.X, iota)}
+	case *ast.UnaryExpr:
+		return &ast.UnaryExpr{Op: t.Op, X: subst_iota(t.X, iota)}
+	case *ast.BinaryExpr:
+		return &ast.BinaryExpr{X: subst_iota(t.X, iota), Op: t.Op, Y: subst_iota(t.Y, iota)}
+	case *ast.CallExpr:
+		args := make([]ast.Expr, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = subst_iota(arg, iota)
+		}
+		return &ast.CallExpr{Fun: t.Fun, Args: args}
+	}
+	return e
+}
+
+// Evaluates the value of a constant, it's unknown if the constant depends on
+// something gocode doesn't know about.
+func (d *decl) eval_const() (v constant.Value) {
+	if d.class != decl_const || d.const_value == nil || d.is_visited() {
+		return constant.MakeUnknown()
+	}
+	d.set_visited()
+	defer d.clear_visited()
+
+	// go/constant panics on invalid operations, e.g. "a" + 1 or 1 / 0
+	defer func() {
+		if err := recover(); err != nil {
+			v = constant.MakeUnknown()
+		}
+	}()
+	v = eval_const_expr(d.const_value, d.scope)
+	if d.typ != nil {
+		v = convert_const(v, d.typ, d.scope)
+	}
+	return v
+}
+
+func eval_const_expr(e ast.Expr, s *scope) constant.Value {
+	switch t := e.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(t.Value, t.Kind, 0)
+	case *ast.Ident:
+		d := s.lookup(t.Name)
+		if d == nil {
+			break
+		}
+		if d.scope == g_universe_scope {
+			switch t.Name {
+			case "true", "false":
+				return constant.MakeBool(t.Name == "true")
+			}
+		}
+		return d.eval_const()
+	case *ast.SelectorExpr:
+		// constants of other packages
+		if x, ok := t.X.(*ast.Ident); ok {
+			if p := s.lookup(x.Name); p != nil && p.class == decl_package {
+				if c := p.find_child(t.Sel.Name); c != nil {
+					return c.eval_const()
+				}
+			}
+		}
+	case *ast.ParenExpr:
+		return eval_const_expr(t.X, s)
+	case *ast.UnaryExpr:
+		return constant.UnaryOp(t.Op, eval_const_expr(t.X, s), unsigned_size(t.X, s))
+	case *ast.BinaryExpr:
+		x := eval_const_expr(t.X, s)
+		y := eval_const_expr(t.Y, s)
+		if x.Kind() == constant.Unknown || y.Kind() == constant.Unknown {
+			break
+		}
+		switch t.Op {
+		case token.SHL, token.SHR:
+			n, ok := constant.Uint64Val(constant.ToInt(y))
+			if !ok {
+				break
+			}
+			return constant.Shift(constant.ToInt(x), t.Op, uint(n))
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return constant.MakeBool(constant.Compare(x, t.Op, y))
+		case token.QUO:
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				// integer division
+				return constant.BinaryOp(x, token.QUO_ASSIGN, y)
+			}
+		}
+		return constant.BinaryOp(x, t.Op, y)
+	case *ast.CallExpr:
+		// conversions, T(x)
+		if d := type_to_decl(t.Fun, s); d != nil && d.class == decl_type && len(t.Args) == 1 {
+			return convert_const(eval_const_expr(t.Args[0], s), t.Fun, s)
+		}
+	}
+	return constant.MakeUnknown()
+}
+
+// Converts the value to the kind of the basic type underlying 't', e.g. 1
+// becomes 1.0 for float64, so that 1 / 3 is not an integer division.
+func convert_const(v constant.Value, t ast.Expr, s *scope) constant.Value {
+	switch basic_type_name(t, s) {
+	case "float32", "float64":
+		return constant.ToFloat(v)
+	case "complex64", "complex128":
+		return constant.ToComplex(v)
+	case "int", "int8", "int16", "int32", "int64", "rune",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte":
+		return constant.ToInt(v)
+	}
+	return v
+}
+
+// Returns the name of the built-in type underlying 't', defined types and
+// aliases aside, or "" if it's not a built-in type.
+func basic_type_name(t ast.Expr, s *scope) string {
+	d := type_to_decl(t, s)
+	if d == nil || d.class != decl_type || d.is_visited() {
+		return ""
+	}
+	if d.scope == g_universe_scope {
+		return d.name
+	}
+	d.set_visited()
+	defer d.clear_visited()
+	return basic_type_name(d.typ, d.scope)
+}
+
+// The result of ^x depends on the size of x if it's an unsigned integer, e.g.
+// ^uint(0), returns 0 for other types.
+func unsigned_size(e ast.Expr, s *scope) uint {
+	var t ast.Expr
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return unsigned_size(x.X, s)
+	case *ast.CallExpr:
+		t = x.Fun
+	case *ast.Ident:
+		if d := s.lookup(x.Name); d != nil && d.class == decl_const {
+			t = d.typ
+		}
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		switch id.Name {
+		case "uint8", "byte":
+			return 8
+		case "uint16":
+			return 16
+		case "uint32":
+			return 32
+		case "uint", "uint64", "uintptr":
+			return 64
+		}
+	}
+	return 0
+}
+
 //-------------------------------------------------------------------------
 // Pretty printing
 //-------------------------------------------------------------------------
@@ -1177,7 +1902,13 @@ func pretty_print_type_expr(out io.Writer, e ast.Expr, canonical_aliases map[str
 		pretty_print_type_expr(out, t.X, canonical_aliases)
 		fmt.Fprintf(out, ".%s", t.Sel.Name)
 	case *ast.FuncType:
-		fmt.Fprintf(out, "func(")
+		fmt.Fprintf(out, "func")
+		if t.TypeParams != nil && len(t.TypeParams.List) > 0 {
+			fmt.Fprintf(out, "[")
+			pretty_print_func_field_list(out, t.TypeParams, canonical_aliases)
+			fmt.Fprintf(out, "]")
+		}
+		fmt.Fprintf(out, "(")
 		pretty_print_func_field_list(out, t.Params, canonical_aliases)
 		fmt.Fprintf(out, ")")
 
@@ -1216,6 +1947,34 @@ func pretty_print_type_expr(out io.Writer, e ast.Expr, canonical_aliases map[str
 		fmt.Fprintf(out, "(")
 		pretty_print_type_expr(out, t.X, canonical_aliases)
 		fmt.Fprintf(out, ")")
+	case *ast.IndexExpr:
+		pretty_print_type_expr(out, t.X, canonical_aliases)
+		fmt.Fprintf(out, "[")
+		pretty_print_type_expr(out, t.Index, canonical_aliases)
+		fmt.Fprintf(out, "]")
+	case *ast.IndexListExpr:
+		pretty_print_type_expr(out, t.X, canonical_aliases)
+		fmt.Fprintf(out, "[")
+		for i, index := range t.Indices {
+			if i != 0 {
+				fmt.Fprintf(out, ", ")
+			}
+			pretty_print_type_expr(out, index, canonical_aliases)
+		}
+		fmt.Fprintf(out, "]")
+	case *ast.UnaryExpr:
+		// ~T in type constraints
+		if t.Op == token.TILDE {
+			fmt.Fprintf(out, "~")
+			pretty_print_type_expr(out, t.X, canonical_aliases)
+		}
+	case *ast.BinaryExpr:
+		// A | B in type constraints
+		if t.Op == token.OR {
+			pretty_print_type_expr(out, t.X, canonical_aliases)
+			fmt.Fprintf(out, " | ")
+			pretty_print_type_expr(out, t.Y, canonical_aliases)
+		}
 	case *ast.BadExpr:
 		// TODO: probably I should check that in a separate function
 		// and simply discard declarations with BadExpr as a part of their
@@ -1339,6 +2098,20 @@ type decl_pack struct {
 type foreach_decl_struct struct {
 	decl_pack
 	decl ast.Decl
+
+	// constants only, the value expressions (the ones of the previous spec
+	// if there are none) and the value of iota in them
+	const_values []ast.Expr
+	iota         int
+}
+
+// Returns the value expression of the i-th constant with iota replaced by its
+// value, nil if it's not a constant.
+func (f *foreach_decl_struct) const_value(i int) ast.Expr {
+	if i >= len(f.const_values) {
+		return nil
+	}
+	return subst_iota(f.const_values[i], f.iota)
 }
 
 func (f *decl_pack) value(i int) ast.Expr {
@@ -1396,13 +2169,26 @@ type foreach_decl_func func(data *foreach_decl_struct)
 func foreach_decl(decl ast.Decl, do foreach_decl_func) {
 	decls := ast_decl_split(decl)
 	var data foreach_decl_struct
-	for _, decl := range decls {
+	var const_typ ast.Expr
+	var const_values []ast.Expr
+	for i, decl := range decls {
 		if !ast_decl_convertable(decl) {
 			continue
 		}
 		data.names = ast_decl_names(decl)
 		data.typ = ast_decl_type(decl)
 		data.values = ast_decl_values(decl)
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.CONST {
+			// const (A T = iota; B), B repeats the type and the value of A
+			if values := gd.Specs[0].(*ast.ValueSpec).Values; len(values) == 0 {
+				data.typ = const_typ
+			} else {
+				const_typ = data.typ
+				const_values = values
+			}
+			data.const_values = const_values
+			data.iota = i
+		}
 		data.decl = decl
 
 		do(&data)
@@ -1442,10 +2228,14 @@ func init() {
 	add_type("uint")
 	add_type("uintptr")
 	add_type("rune")
+	add_type("comparable")
 
 	add_const := func(name string) {
 		d := new_decl(name, decl_const, g_universe_scope)
 		d.typ = builtin
+		if name == "true" || name == "false" {
+			d.const_value = ast.NewIdent(name)
+		}
 		g_universe_scope.add_named_decl(d)
 	}
 	add_const("true")
@@ -1489,4 +2279,9 @@ func init() {
 		},
 	}
 	g_universe_scope.add_named_decl(d)
+
+	// built-in any alias
+	d = new_decl("any", decl_type, g_universe_scope)
+	d.typ = &ast.InterfaceType{}
+	g_universe_scope.add_named_decl(d)
 }
@@ -104,18 +104,29 @@ func (f *decl_file_cache) read_file() {
 func (f *decl_file_cache) process_data(data []byte) {
 	var file *ast.File
 	f.fset = token.NewFileSet()
-	file, f.error = parser.ParseFile(f.fset, "", data, 0)
+	file, f.error = parser.ParseFile(f.fset, f.name, data, doc_parser_mode())
 	f.filescope = new_scope(nil)
+	f.filescope.position = f.fset.Position
 	for _, d := range file.Decls {
 		anonymify_ast(d, 0, f.filescope)
 	}
 	f.packages = collect_package_imports(f.name, file.Decls, f.context)
+	redirect_package_under_test(f.name, package_name(file), f.packages, f.context)
 	f.decls = make(map[string]*decl, len(file.Decls))
 	for _, decl := range file.Decls {
 		append_to_top_decls(f.decls, decl, f.filescope)
 	}
 }
 
+// Comments are parsed only if they are attached to declarations, see the
+// "doc-comments" config option.
+func doc_parser_mode() parser.Mode {
+	if g_config.DocComments {
+		return parser.ParseComments
+	}
+	return 0
+}
+
 func append_to_top_decls(decls map[string]*decl, decl ast.Decl, scope *scope) {
 	foreach_decl(decl, func(data *foreach_decl_struct) {
 		class := ast_decl_class(data.decl)
@@ -126,6 +137,10 @@ func append_to_top_decls(decls map[string]*decl, decl ast.Decl, scope *scope) {
 			if d == nil {
 				return
 			}
+			d.tparams = ast_decl_type_params(data.decl)
+			d.set_doc(ast_decl_doc(data.decl))
+			d.set_pos(name.Pos())
+			d.const_value = data.const_value(i)
 
 			methodof := method_of(decl)
 			if methodof != "" {
@@ -149,13 +164,33 @@ func append_to_top_decls(decls map[string]*decl, decl ast.Decl, scope *scope) {
 	})
 }
 
+// An external test package (package foo_test) imports the package under test,
+// it's loaded from the source code along with its in-package test files (e.g.
+// export_test.go), an archive knows nothing about the latter.
+func redirect_package_under_test(filename, package_name string, pkgs []package_import, context *package_lookup_context) {
+	if !strings.HasSuffix(package_name, "_test") {
+		return
+	}
+	dir := filepath.Dir(filename)
+	for i := range pkgs {
+		p := &pkgs[i]
+		if p.abspath == dir || (context.CurrentPackagePath != "" && p.path == context.CurrentPackagePath) {
+			p.abspath = dir + g_test_package_suffix
+		}
+	}
+}
+
 func abs_path_for_package(filename, p string, context *package_lookup_context) (string, bool) {
 	dir, _ := filepath.Split(filename)
 	if len(p) == 0 {
 		return "", false
 	}
 	if p[0] == '.' {
-		return fmt.Sprintf("%s.a", filepath.Join(dir, p)), true
+		pkgdir := filepath.Join(dir, p)
+		if pkgfile := pkgdir + ".a"; file_exists(pkgfile) || !is_dir(pkgdir) {
+			return pkgfile, true
+		}
+		return pkgdir, true
 	}
 	pkg, ok := find_go_dag_package(p, dir)
 	if ok {
@@ -276,6 +311,12 @@ func log_build_context(context *package_lookup_context) {
 	log.Printf(" GOARCH: %s\n", context.GOARCH)
 	log.Printf(" BzlProjectRoot: %q\n", context.BzlProjectRoot)
 	log.Printf(" GBProjectRoot: %q\n", context.GBProjectRoot)
+	if context.GoWorkspace != nil {
+		log.Printf(" GoWorkspace: %q\n", context.GoWorkspace.gowork)
+	}
+	if context.GoModule != nil {
+		log.Printf(" GoModule: %q at %q\n", context.GoModule.path, context.GoModule.dir)
+	}
 	log.Printf(" lib-path: %q\n", g_config.LibPath)
 }
 
@@ -360,6 +401,25 @@ func find_global_file(imp string, context *package_lookup_context) (string, bool
 		}
 	}
 
+	// module-specific lookup mode, only if the go.work or go.mod file was
+	// found, workspace modules win over the module cache
+	if g_config.PackageLookupMode == "module" {
+		dir := ""
+		if context.GoWorkspace != nil {
+			dir = context.GoWorkspace.package_dir(imp, context.module_cache())
+		}
+		if dir == "" && context.GoModule != nil {
+			dir = context.GoModule.package_dir(imp, context.module_cache())
+		}
+		if is_dir(dir) {
+			log_found_package_maybe(imp, dir)
+			return dir, true
+		}
+	}
+
+	// if there is no archive, but the source code is around, we'll use it
+	srcdir := ""
+
 	if context.CurrentPackagePath != "" {
 		// Try vendor path first, see GO15VENDOREXPERIMENT.
 		// We don't check this environment variable however, seems like there is
@@ -378,6 +438,9 @@ func find_global_file(imp string, context *package_lookup_context) (string, bool
 					log_found_package_maybe(imp, p.PkgObj)
 					return p.PkgObj, true
 				}
+				if srcdir == "" && is_dir(p.Dir) {
+					srcdir = p.Dir
+				}
 			}
 			if package_path == "" {
 				break
@@ -397,6 +460,14 @@ func find_global_file(imp string, context *package_lookup_context) (string, bool
 			log_found_package_maybe(imp, p.PkgObj)
 			return p.PkgObj, true
 		}
+		if srcdir == "" && is_dir(p.Dir) {
+			srcdir = p.Dir
+		}
+	}
+
+	if srcdir != "" {
+		log_found_package_maybe(imp, srcdir)
+		return srcdir, true
 	}
 
 	if *g_debug {
@@ -422,8 +493,13 @@ func package_name(file *ast.File) string {
 
 type package_lookup_context struct {
 	build.Context
+	GOMODCACHE         string
+	GOFLAGS            string
+	GOWORK             string
 	BzlProjectRoot     string
 	GBProjectRoot      string
+	GoWorkspace        *go_workspace
+	GoModule           *go_module
 	CurrentPackagePath string
 }
 
@@ -496,10 +572,46 @@ func (ctxt *package_lookup_context) pkg_dirs() (string, []string) {
 		}
 	case "bzl":
 		// TODO: Support bazel mode
+	case "module":
+		// there are no archives in module mode, see import_roots
+		currentPackagePath = ctxt.CurrentPackagePath
 	}
 	return currentPackagePath, all
 }
 
+// import_roots returns source directories of importable packages along with
+// their import paths, in module mode there are no archives to look for.
+func (ctxt *package_lookup_context) import_roots() []import_root {
+	if g_config.PackageLookupMode != "module" {
+		return nil
+	}
+	var roots []import_root
+	switch {
+	case ctxt.GoWorkspace != nil:
+		roots = ctxt.GoWorkspace.import_roots(ctxt.module_cache())
+	case ctxt.GoModule != nil:
+		roots = ctxt.GoModule.import_roots(ctxt.module_cache())
+	default:
+		return nil
+	}
+	if ctxt.GOROOT != "" {
+		roots = append(roots, import_root{dir: filepath.Join(ctxt.GOROOT, "src")})
+	}
+	return roots
+}
+
+// module_cache returns the module cache directory, $GOPATH/pkg/mod unless
+// $GOMODCACHE is set.
+func (ctxt *package_lookup_context) module_cache() string {
+	if ctxt.GOMODCACHE != "" {
+		return ctxt.GOMODCACHE
+	}
+	if all := filepath.SplitList(ctxt.GOPATH); len(all) > 0 && all[0] != "" {
+		return filepath.Join(all[0], "pkg", "mod")
+	}
+	return ""
+}
+
 type decl_cache struct {
 	cache   map[string]*decl_file_cache
 	context *package_lookup_context
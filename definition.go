@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+)
+
+//-------------------------------------------------------------------------
+// definition
+//
+// Position of the declaration of the identifier under the cursor, see
+// "gocode definition".
+//-------------------------------------------------------------------------
+
+// Returns the position of the declaration the identifier under the cursor
+// refers to, the identifier may be a part of a selector expression.
+func (c *auto_complete_context) definition(file []byte, filename string, cursor int) (token.Position, error) {
+	d, err := c.deduce_ident_decl(file, filename, cursor)
+	if err != nil {
+		return token.Position{}, err
+	}
+	if d.pos.Line == 0 {
+		return token.Position{}, fmt.Errorf("position of the declaration is unknown: %s", d.name)
+	}
+	return d.pos, nil
+}
+
+// Parses the current file and finds the declaration the identifier under the
+// cursor refers to, the cursor may be anywhere within the identifier or right
+// after it. Examples (# - the cursor):
+//
+//	fmt.Pri#ntln // fmt.Println
+//	t.Field#     // the field of the type of t
+//	T{Fie#ld: 1} // T.Field
+//	goto L#      // the label, "L#:" as well
+func (c *auto_complete_context) deduce_ident_decl(file []byte, filename string, cursor int) (*decl, error) {
+	cursor = ident_end(file, cursor)
+	if cursor == -1 {
+		return nil, fmt.Errorf("no identifier under the cursor")
+	}
+
+	c.update_current(file, filename, cursor)
+
+	iter := new_token_iterator(file, cursor)
+	name := iter.token().literal()
+	// members and labels aren't looked up in the scope
+	rest := bytes.TrimSpace(file[cursor:])
+	colon := bytes.HasPrefix(rest, []byte(":")) && !bytes.HasPrefix(rest, []byte(":="))
+	var d *decl
+	scoped := true
+	if iter.go_back() {
+		switch iter.token().tok {
+		case token.PERIOD:
+			if x, _ := c.deduce_cursor_decl(&iter); x != nil {
+				d = x.find_child_and_in_embedded(name)
+			}
+			scoped = false
+		case token.GOTO, token.BREAK, token.CONTINUE, token.SEMICOLON:
+			if iter.token().tok == token.SEMICOLON && !colon {
+				break
+			}
+			if c.current.labels != nil {
+				d = c.current.labels.lookup(name)
+			}
+			scoped = false
+		case token.LBRACE, token.COMMA:
+			if colon {
+				if x, _ := c.deduce_struct_type_decl(&iter); x != nil {
+					d = x.find_child_and_in_embedded(name)
+					scoped = false
+				}
+			}
+		}
+	}
+	if scoped {
+		d = c.current.scope.lookup(name)
+	}
+	if d == nil {
+		return nil, fmt.Errorf("declaration not found: %s", name)
+	}
+	return d, nil
+}
+
+// Parses the current file and updates the caches, unlike autocompletion the
+// file is parsed as is, without a filler at the cursor.
+func (c *auto_complete_context) update_current(file []byte, filename string, cursor int) {
+	c.current.cursor = cursor
+	c.current.name = filename
+	c.current.process_data(file)
+	c.update_caches()
+}
+
+// Returns the offset of the end of the identifier the cursor is within or
+// right after, -1 if there is no such identifier.
+func ident_end(file []byte, cursor int) int {
+	if cursor < 0 || cursor > len(file) {
+		return -1
+	}
+	iter := new_token_iterator(file, cursor+1)
+	if len(iter.tokens) == 0 {
+		return -1
+	}
+	// "ident#." is the end of the identifier, not the start of '.'
+	if iter.token().off == cursor && iter.token().tok != token.IDENT {
+		if !iter.go_back() {
+			return -1
+		}
+	}
+	tok := iter.token()
+	end := tok.off + len(tok.lit)
+	if tok.tok != token.IDENT || cursor > end {
+		return -1
+	}
+	return end
+}
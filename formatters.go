@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"go/token"
 	"strings"
 )
 
@@ -65,11 +67,22 @@ func (*vim_formatter) write_candidates(candidates []candidate, num int) {
 		if c.Class == decl_func {
 			abbr = fmt.Sprintf("%s %s%s", c.Class, c.Name, c.Type[len("func"):])
 		}
-		fmt.Printf("{'word': '%s', 'abbr': '%s', 'info': '%s'}", word, abbr, abbr)
+		info := abbr
+		if c.Doc != "" {
+			info += "\n\n" + c.Doc
+		}
+		fmt.Printf("{'word': '%s', 'abbr': '%s', 'info': %s, 'user_data': %s}", word, abbr, vim_string(info), vim_string(c.Snippet))
 	}
 	fmt.Printf("]]")
 }
 
+// Doc comments span multiple lines, unlike single-quoted strings
+// double-quoted ones have escape sequences.
+func vim_string(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
 //-------------------------------------------------------------------------
 // godit_formatter
 //-------------------------------------------------------------------------
@@ -157,12 +170,124 @@ func (*json_formatter) write_candidates(candidates []candidate, num int) {
 		if i != 0 {
 			fmt.Printf(", ")
 		}
-		fmt.Printf(`{"class": "%s", "name": "%s", "type": "%s", "package": "%s"}`,
-			c.Class, c.Name, c.Type, c.Package)
+		// snippets are escaped with backslashes
+		snippet, _ := json.Marshal(c.Snippet)
+		edits := []byte("[]")
+		if c.Edits != nil {
+			edits, _ = json.Marshal(c.Edits)
+		}
+		doc, _ := json.Marshal(c.Doc)
+		fmt.Printf(`{"class": "%s", "name": "%s", "type": "%s", "package": "%s", "type_match": %t, "snippet": %s, "required": %t, "edits": %s, "doc": %s, "deprecated": %t, "member": "%s", "promoted_from": "%s"}`,
+			c.Class, c.Name, c.Type, c.Package, c.TypeMatch, snippet, c.Required, edits, doc, c.Deprecated, c.Member, c.Promoted)
 	}
 	fmt.Print("]]")
 }
 
+//-------------------------------------------------------------------------
+// type_info output, see "gocode type"
+//-------------------------------------------------------------------------
+
+func write_type_info(format string, t type_info) {
+	if format == "json" {
+		name, _ := json.Marshal(t.Name)
+		typ, _ := json.Marshal(t.Type)
+		value, _ := json.Marshal(t.Value)
+		doc, _ := json.Marshal(t.Doc)
+		fmt.Printf(`{"class": "%s", "name": %s, "type": %s, "package": "%s", "value": %s, "doc": %s}`,
+			t.Class, name, typ, t.Package, value, doc)
+		return
+	}
+
+	abbr := fmt.Sprintf("%s %s %s", t.Class, t.Name, t.Type)
+	if t.Name == "" {
+		// results of a call, a tuple
+		abbr = t.Type
+	} else if t.Class == decl_func && strings.HasPrefix(t.Type, "func") {
+		abbr = fmt.Sprintf("%s %s%s", t.Class, t.Name, t.Type[len("func"):])
+	}
+	if t.Value != "" {
+		abbr += " = " + t.Value
+	}
+	fmt.Printf("%s\n", strings.TrimSpace(abbr))
+	if t.Package != "" {
+		fmt.Printf("package %s\n", t.Package)
+	}
+	if t.Doc != "" {
+		fmt.Printf("\n%s", t.Doc)
+	}
+}
+
+//-------------------------------------------------------------------------
+// signature output, see "gocode signature"
+//-------------------------------------------------------------------------
+
+func write_signatures(format string, signatures []signature) {
+	switch format {
+	case "json":
+		fmt.Print("[")
+		for i, s := range signatures {
+			if i != 0 {
+				fmt.Printf(", ")
+			}
+			typ, _ := json.Marshal(s.Type)
+			params := []byte("[]")
+			if s.Params != nil {
+				params, _ = json.Marshal(s.Params)
+			}
+			doc, _ := json.Marshal(s.Doc)
+			fmt.Printf(`{"name": "%s", "type": %s, "params": %s, "param": %d, "package": "%s", "doc": %s, "promoted_from": "%s"}`,
+				s.Name, typ, params, s.Param, s.Package, doc, s.Promoted)
+		}
+		fmt.Print("]")
+	case "csv":
+		for _, s := range signatures {
+			fmt.Printf("%s,,%s,,%d,,%s\n", s.Name, s.Type, s.Param, s.Promoted)
+		}
+	default:
+		fmt.Printf("Found %d signatures:\n", len(signatures))
+		for _, s := range signatures {
+			abbr := s.Type
+			if s.Name != "" && strings.HasPrefix(s.Type, "func") {
+				abbr = fmt.Sprintf("func %s%s", s.Name, s.Type[len("func"):])
+			}
+			if s.Param != -1 {
+				abbr += fmt.Sprintf(", parameter %d %q", s.Param, s.Params[s.Param])
+			}
+			if s.Promoted != "" {
+				abbr += ", promoted from " + s.Promoted
+			}
+			fmt.Printf("  %s\n", abbr)
+		}
+	}
+}
+
+//-------------------------------------------------------------------------
+// references output, see "gocode references"
+//-------------------------------------------------------------------------
+
+func write_references(format string, refs []token.Position) {
+	switch format {
+	case "json":
+		fmt.Print("[")
+		for i, r := range refs {
+			if i != 0 {
+				fmt.Printf(", ")
+			}
+			filename, _ := json.Marshal(r.Filename)
+			fmt.Printf(`{"filename": %s, "line": %d, "column": %d}`, filename, r.Line, r.Column)
+		}
+		fmt.Print("]")
+	case "csv":
+		for _, r := range refs {
+			fmt.Printf("%s,,%d,,%d\n", r.Filename, r.Line, r.Column)
+		}
+	default:
+		for _, r := range refs {
+			fmt.Printf("%s\n", r)
+		}
+	}
+}
+
 //-------------------------------------------------------------------------
 
 func get_formatter(name string) formatter {
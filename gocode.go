@@ -40,10 +40,15 @@ func show_usage() {
 		"\nCommands:\n"+
 			"  autocomplete [<path>] <offset>     main autocompletion command\n"+
 			"  close                              close the gocode daemon\n"+
+			"  definition [<path>] <offset>       position of the declaration\n"+
 			"  drop-cache                         drop gocode daemon's cache\n"+
+			"  impl [<path>] <recv> <iface>       method stubs implementing an interface\n"+
 			"  options                            list config options (extended)\n"+
+			"  references [<path>] <offset>       uses of the identifier under the cursor\n"+
 			"  set [<name> [<value>]]             list or set config options\n"+
+			"  signature [<path>] <offset>        signature help for the call under the cursor\n"+
 			"  status                             gocode daemon status report\n"+
+			"  type [<path>] <offset>             type of the expression under the cursor\n"+
 			"")
 }
 
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//-------------------------------------------------------------------------
+// go_module
+//
+// The main module of a file, described by the closest go.mod file up the
+// directory tree. Used by the "module" package lookup mode to find the
+// source code of imported packages: in the main module itself, in the module
+// cache, in local replacement directories or in the vendor directory.
+//-------------------------------------------------------------------------
+
+type go_module struct {
+	gomod      string // go.mod file name
+	mtime      int64  // go.mod and vendor/modules.txt modification time
+	dir        string // module root directory
+	path       string // module path
+	go_version string
+
+	requires map[string]string         // module path -> version
+	replaces map[string]module_replace // "path" or "path@version" -> replacement
+
+	// vendored packages -> module path, nil if the vendor directory is not
+	// used
+	vendor map[string]string
+}
+
+type module_replace struct {
+	path    string
+	version string // empty for local directory replacements
+}
+
+type import_root struct {
+	dir    string
+	path   string // import path of the directory, empty for GOROOT/src
+	pkgdir string // installed archives of the packages, if any
+}
+
+// Finds go.mod file for 'filename', parses it and returns the module, the
+// 'cached' one is returned if nothing has changed since the last time.
+func find_go_module(filename string, cached *go_module, goflags string) (*go_module, error) {
+	dir := filepath.Dir(filename)
+	start := dir
+	for {
+		gomod := filepath.Join(dir, "go.mod")
+		if stat, err := os.Stat(gomod); err == nil && !stat.IsDir() {
+			mtime := stat.ModTime().UnixNano()
+			if stat, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt")); err == nil {
+				mtime += stat.ModTime().UnixNano()
+			}
+			if cached != nil && cached.gomod == gomod && cached.mtime == mtime {
+				return cached, nil
+			}
+			m, err := parse_go_module(gomod, goflags)
+			if err != nil {
+				return nil, err
+			}
+			m.mtime = mtime
+			return m, nil
+		}
+		next := filepath.Dir(dir)
+		if next == dir {
+			break
+		}
+		dir = next
+	}
+	return nil, fmt.Errorf("could not find go.mod in %q or its parents", start)
+}
+
+func parse_go_module(gomod, goflags string) (*go_module, error) {
+	data, err := file_reader.read_file(gomod)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &go_module{
+		gomod:    gomod,
+		dir:      filepath.Dir(gomod),
+		requires: make(map[string]string),
+		replaces: make(map[string]module_replace),
+	}
+	if err := parse_go_mod_directives(gomod, data, m.add_directive); err != nil {
+		return nil, err
+	}
+	if m.path == "" {
+		return nil, fmt.Errorf("%s: no module directive", gomod)
+	}
+	if m.use_vendor(goflags) {
+		m.vendor = parse_vendor_modules(filepath.Join(m.dir, "vendor", "modules.txt"))
+	}
+	return m, nil
+}
+
+func (m *go_module) add_directive(verb string, args []string) {
+	switch verb {
+	case "module":
+		if len(args) == 1 {
+			m.path = args[0]
+		}
+	case "go":
+		if len(args) == 1 {
+			m.go_version = args[0]
+		}
+	case "require":
+		if len(args) == 2 {
+			m.requires[args[0]] = args[1]
+		}
+	case "replace":
+		add_replace_directive(m.replaces, args)
+	}
+}
+
+// Calls 'directive' for each directive of go.mod or go.work file, directive
+// blocks are unfolded.
+func parse_go_mod_directives(filename string, data []byte, directive func(verb string, args []string)) error {
+	block := ""
+	for n, line := range strings.Split(string(data), "\n") {
+		args, err := split_go_mod_line(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", filename, n+1, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if block != "" {
+			if args[0] == ")" {
+				block = ""
+				continue
+			}
+			directive(block, args)
+			continue
+		}
+		if len(args) == 2 && args[1] == "(" {
+			block = args[0]
+			continue
+		}
+		directive(args[0], args[1:])
+	}
+	return nil
+}
+
+// old [version] => new [version]
+func add_replace_directive(replaces map[string]module_replace, args []string) {
+	i := 0
+	for i < len(args) && args[i] != "=>" {
+		i++
+	}
+	if i == 0 || i > 2 || len(args)-i-1 < 1 || len(args)-i-1 > 2 {
+		return
+	}
+	key := args[0]
+	if i == 2 {
+		key += "@" + args[1]
+	}
+	r := module_replace{path: args[i+1]}
+	if len(args)-i-1 == 2 {
+		r.version = args[i+2]
+	}
+	replaces[key] = r
+}
+
+// Splits go.mod line into fields, handles comments and quoted strings.
+func split_go_mod_line(line string) ([]string, error) {
+	var args []string
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" || strings.HasPrefix(line, "//") {
+			return args, nil
+		}
+		switch line[0] {
+		case '(', ')':
+			args = append(args, line[:1])
+			line = line[1:]
+		case '"', '`':
+			end := strings.IndexByte(line[1:], line[0])
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(line[:end+2])
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, s)
+			line = line[end+2:]
+		default:
+			end := strings.IndexFunc(line, func(r rune) bool {
+				return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+			})
+			if i := strings.Index(line, "//"); i != -1 && (end == -1 || i < end) {
+				end = i
+			}
+			if end == -1 {
+				end = len(line)
+			}
+			args = append(args, line[:end])
+			line = line[end:]
+		}
+	}
+}
+
+// The go command uses vendor directory by default if it's consistent with
+// go.mod and the module requires go 1.14 or later. We don't check the
+// consistency, the presence of vendor/modules.txt is enough.
+func (m *go_module) use_vendor(goflags string) bool {
+	for _, flag := range strings.Fields(goflags) {
+		switch strings.TrimLeft(flag, "-") {
+		case "mod=vendor":
+			return true
+		case "mod=mod", "mod=readonly":
+			return false
+		}
+	}
+	if !file_exists(filepath.Join(m.dir, "vendor", "modules.txt")) {
+		return false
+	}
+	major, minor := 0, 0
+	fmt.Sscanf(m.go_version, "%d.%d", &major, &minor)
+	return major > 1 || (major == 1 && minor >= 14)
+}
+
+// Parses vendor/modules.txt, it lists vendored modules followed by their
+// packages:
+//
+//	# golang.org/x/text v0.3.0
+//	## explicit
+//	golang.org/x/text/unicode/norm
+func parse_vendor_modules(filename string) map[string]string {
+	vendor := make(map[string]string)
+	data, err := file_reader.read_file(filename)
+	if err != nil {
+		return vendor
+	}
+	module := ""
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case strings.HasPrefix(line, "## "):
+			// annotations of the current module
+		case strings.HasPrefix(line, "# "):
+			if f := strings.Fields(line[2:]); len(f) > 0 {
+				module = f[0]
+			}
+		case line != "" && module != "":
+			vendor[line] = module
+		}
+	}
+	return vendor
+}
+
+// Returns the import path of a package in 'dir', which is supposed to be
+// somewhere in the main module.
+func (m *go_module) import_path(dir string) string {
+	rel, err := filepath.Rel(m.dir, dir)
+	if err != nil || rel == "." {
+		return m.path
+	}
+	return m.path + "/" + filepath.ToSlash(rel)
+}
+
+// Returns the directory of the imported package 'imp' or an empty string if
+// it's not provided by the main module or its requirements, e.g. it's a
+// standard library package.
+func (m *go_module) package_dir(imp, modcache string) string {
+	if rest, ok := trim_module_path(imp, m.path); ok {
+		return filepath.Join(m.dir, filepath.FromSlash(rest))
+	}
+	if m.vendor != nil {
+		if _, ok := m.vendor[imp]; ok {
+			return filepath.Join(m.dir, "vendor", filepath.FromSlash(imp))
+		}
+		return ""
+	}
+
+	// the longest module path wins
+	mod := ""
+	for path := range m.requires {
+		if _, ok := trim_module_path(imp, path); ok && len(path) > len(mod) {
+			mod = path
+		}
+	}
+	if mod == "" {
+		return ""
+	}
+	rest, _ := trim_module_path(imp, mod)
+	return filepath.Join(m.module_dir(mod, modcache), filepath.FromSlash(rest))
+}
+
+// Returns the root directory of a required module, replacements are taken
+// into account.
+func (m *go_module) module_dir(mod, modcache string) string {
+	dir, _ := module_version_dir(mod, m.requires[mod], m.replaces, m.dir, modcache)
+	return dir
+}
+
+// Returns the root directory of a module version and whether it was replaced,
+// 'replaces' come from go.mod or go.work file in 'dir', local replacements
+// are relative to it.
+func module_version_dir(mod, version string, replaces map[string]module_replace, dir, modcache string) (string, bool) {
+	r, ok := replaces[mod+"@"+version]
+	if !ok {
+		r, ok = replaces[mod]
+	}
+	if ok {
+		if r.version == "" {
+			// local directory replacement
+			if filepath.IsAbs(r.path) {
+				return filepath.Clean(r.path), true
+			}
+			return filepath.Join(dir, filepath.FromSlash(r.path)), true
+		}
+		mod, version = r.path, r.version
+	}
+	return filepath.Join(modcache, escape_module_path(mod)+"@"+escape_module_path(version)), ok
+}
+
+// Returns directories with their import paths, where importable packages
+// of the module reside.
+func (m *go_module) import_roots(modcache string) []import_root {
+	roots := []import_root{{dir: m.dir, path: m.path}}
+	if m.vendor != nil {
+		modules := make(map[string]bool)
+		for _, mod := range m.vendor {
+			modules[mod] = true
+		}
+		for mod := range modules {
+			dir := filepath.Join(m.dir, "vendor", filepath.FromSlash(mod))
+			roots = append(roots, import_root{dir: dir, path: mod})
+		}
+	} else {
+		for mod := range m.requires {
+			roots = append(roots, import_root{dir: m.module_dir(mod, modcache), path: mod})
+		}
+	}
+	return roots
+}
+
+// Returns 'imp' without the module path prefix, if it's a package of the
+// module 'mod'.
+func trim_module_path(imp, mod string) (string, bool) {
+	if imp == mod {
+		return "", true
+	}
+	if strings.HasPrefix(imp, mod) && imp[len(mod)] == '/' {
+		return imp[len(mod):], true
+	}
+	return "", false
+}
+
+// Module cache uses case-insensitive names: upper case letters are replaced
+// with '!' followed by the lower case letter.
+func escape_module_path(path string) string {
+	var buf bytes.Buffer
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			buf.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// Compares module versions: v1.2.3 < v1.10.0, pre-releases and pseudo-versions
+// are compared lexically.
+func module_version_less(a, b string) bool {
+	var amajor, aminor, apatch, bmajor, bminor, bpatch int
+	an, _ := fmt.Sscanf(a, "v%d.%d.%d", &amajor, &aminor, &apatch)
+	bn, _ := fmt.Sscanf(b, "v%d.%d.%d", &bmajor, &bminor, &bpatch)
+	switch {
+	case an != bn:
+		return an < bn
+	case amajor != bmajor:
+		return amajor < bmajor
+	case aminor != bminor:
+		return aminor < bminor
+	case apatch != bpatch:
+		return apatch < bpatch
+	}
+	return a < b
+}
+
+//-------------------------------------------------------------------------
+// go_workspace
+//
+// A set of modules developed side by side, described by go.work file. Used
+// modules win over the module cache, so that completion reflects changes of
+// their source code right away.
+//-------------------------------------------------------------------------
+
+type go_workspace struct {
+	gowork  string // go.work file name
+	mtime   int64  // go.work modification time
+	dir     string // workspace root directory
+	modules []*go_module
+
+	replaces map[string]module_replace // go.work replacements win
+}
+
+// Finds go.work file for 'filename' (or uses $GOWORK), parses it and returns
+// the workspace, the 'cached' one is returned if nothing has changed since
+// the last time.
+func find_go_workspace(filename string, cached *go_workspace, gowork string) (*go_workspace, error) {
+	switch gowork {
+	case "off":
+		return nil, fmt.Errorf("workspace mode is disabled by GOWORK=off")
+	case "":
+		dir := filepath.Dir(filename)
+		for {
+			if file_exists(filepath.Join(dir, "go.work")) {
+				gowork = filepath.Join(dir, "go.work")
+				break
+			}
+			next := filepath.Dir(dir)
+			if next == dir {
+				return nil, fmt.Errorf("could not find go.work in %q or its parents", filepath.Dir(filename))
+			}
+			dir = next
+		}
+	}
+
+	stat, err := os.Stat(gowork)
+	if err != nil {
+		return nil, err
+	}
+	mtime := stat.ModTime().UnixNano()
+	if cached != nil && cached.gowork == gowork && cached.mtime == mtime && cached.up_to_date() {
+		return cached, nil
+	}
+
+	data, err := file_reader.read_file(gowork)
+	if err != nil {
+		return nil, err
+	}
+	w := &go_workspace{
+		gowork:   gowork,
+		mtime:    mtime,
+		dir:      filepath.Dir(gowork),
+		replaces: make(map[string]module_replace),
+	}
+	err = parse_go_mod_directives(gowork, data, func(verb string, args []string) {
+		switch verb {
+		case "use":
+			if len(args) != 1 {
+				return
+			}
+			dir := filepath.FromSlash(args[0])
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(w.dir, dir)
+			}
+			// broken modules are skipped, the go command would complain
+			// about them, but we can do something useful anyway
+			m, err := find_go_module(filepath.Join(dir, "go.mod"), nil, "")
+			if err == nil && m.dir == dir {
+				// workspace modules never use their vendor directories
+				m.vendor = nil
+				w.modules = append(w.modules, m)
+			}
+		case "replace":
+			add_replace_directive(w.replaces, args)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Checks whether go.mod files of used modules were modified.
+func (w *go_workspace) up_to_date() bool {
+	for _, m := range w.modules {
+		if cached, err := find_go_module(m.gomod, m, ""); err != nil || cached != m {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the directory of the imported package 'imp' or an empty string if
+// it's not provided by the workspace modules or their requirements.
+func (w *go_workspace) package_dir(imp, modcache string) string {
+	// used modules win
+	var used *go_module
+	for _, m := range w.modules {
+		if _, ok := trim_module_path(imp, m.path); ok {
+			if used == nil || len(m.path) > len(used.path) {
+				used = m
+			}
+		}
+	}
+	if used != nil {
+		rest, _ := trim_module_path(imp, used.path)
+		return filepath.Join(used.dir, filepath.FromSlash(rest))
+	}
+
+	// the longest module path wins, then the highest version
+	var owner *go_module
+	mod, version := "", ""
+	for _, m := range w.modules {
+		for path, v := range m.requires {
+			if _, ok := trim_module_path(imp, path); !ok {
+				continue
+			}
+			if len(path) > len(mod) || (path == mod && module_version_less(version, v)) {
+				owner, mod, version = m, path, v
+			}
+		}
+	}
+	if owner == nil {
+		return ""
+	}
+	rest, _ := trim_module_path(imp, mod)
+	return filepath.Join(w.module_dir(owner, mod, version, modcache), filepath.FromSlash(rest))
+}
+
+func (w *go_workspace) module_dir(owner *go_module, mod, version, modcache string) string {
+	if dir, ok := module_version_dir(mod, version, w.replaces, w.dir, modcache); ok {
+		return dir
+	}
+	dir, _ := module_version_dir(mod, version, owner.replaces, owner.dir, modcache)
+	return dir
+}
+
+// Returns directories with their import paths, where importable packages
+// of the workspace reside.
+func (w *go_workspace) import_roots(modcache string) []import_root {
+	var roots []import_root
+	used := make(map[string]bool)
+	for _, m := range w.modules {
+		roots = append(roots, import_root{dir: m.dir, path: m.path})
+		used[m.path] = true
+	}
+	for _, m := range w.modules {
+		for mod := range m.requires {
+			if used[mod] {
+				continue
+			}
+			used[mod] = true
+			dir := w.package_dir(mod, modcache)
+			if dir != "" {
+				roots = append(roots, import_root{dir: dir, path: mod})
+			}
+		}
+	}
+	return roots
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//-------------------------------------------------------------------------
+// interface implementation stubs
+//
+// Method stubs a type lacks to implement an interface, see "gocode impl".
+//-------------------------------------------------------------------------
+
+// Returns stubs for the methods of interface 'iface' which the receiver type
+// is missing. Both are written as in Go source, the receiver may be named:
+//
+//	gocode impl 'f *File' io.ReadWriteCloser
+func (c *auto_complete_context) impl(file []byte, filename, recv, iface string) (string, error) {
+	c.current.cursor = -1
+	c.current.name = filename
+	c.current.process_data(file)
+	c.update_caches()
+
+	recv_name, recv_type := split_receiver(recv)
+	rexpr, err := parser.ParseExpr(recv_type)
+	if err != nil {
+		return "", fmt.Errorf("invalid receiver type: %s", recv_type)
+	}
+	if recv_name == "" {
+		recv_name = receiver_name(rexpr)
+	}
+
+	d := c.interface_type_decl(iface)
+	if d != nil && d.is_alias() {
+		d = d.type_dealias()
+	}
+	if d == nil || d.class != decl_type {
+		return "", fmt.Errorf("interface type not found: %s", iface)
+	}
+	d = advance_to_struct_or_interface(d)
+	if d == nil {
+		return "", fmt.Errorf("not an interface type: %s", iface)
+	}
+	if _, ok := d.typ.(*ast.InterfaceType); !ok {
+		return "", fmt.Errorf("not an interface type: %s", iface)
+	}
+
+	// the method set, including embedded interfaces
+	b := new_out_buffers(c)
+	c.get_candidates_from_decl(cursor_context{decl: d}, decl_func, b)
+	sort.Sort(b)
+
+	// methods the receiver has already, its type may be not declared yet
+	rd := type_to_decl(rexpr, c.current.scope)
+	if rd != nil && rd.class != decl_type {
+		rd = nil
+	}
+
+	var buf bytes.Buffer
+	for _, m := range b.candidates {
+		if rd != nil && rd.find_child_and_in_embedded(m.Name) != nil {
+			continue
+		}
+		if buf.Len() != 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "func (%s %s) %s%s {\n\tpanic(\"not implemented\")\n}\n",
+			recv_name, recv_type, m.Name, m.Type[len("func"):])
+	}
+	return buf.String(), nil
+}
+
+// Finds the declaration of the interface type, the qualifier is the import
+// name of a package imported by the file or an import path otherwise:
+// "io.Writer", "encoding/json.Marshaler".
+func (c *auto_complete_context) interface_type_decl(iface string) *decl {
+	if e, err := parser.ParseExpr(iface); err == nil {
+		if d := type_to_decl(e, c.current.scope); d != nil {
+			return d
+		}
+	}
+	i := strings.LastIndex(iface, ".")
+	if i == -1 {
+		return nil
+	}
+	p := c.load_package(iface[:i])
+	if p == nil {
+		return nil
+	}
+	return p.main.find_child(iface[i+1:])
+}
+
+// Splits "f *File" into "f" and "*File", the name is optional.
+func split_receiver(recv string) (string, string) {
+	recv = strings.TrimSpace(recv)
+	i := strings.IndexFunc(recv, unicode.IsSpace)
+	if i == -1 {
+		return "", recv
+	}
+	name := recv[:i]
+	if token.IsIdentifier(name) {
+		return name, strings.TrimSpace(recv[i:])
+	}
+	return "", recv
+}
+
+// The first letter of the type name in lower case: "f" for "*File".
+func receiver_name(t ast.Expr) string {
+	name := get_type_path(t).name
+	r, _ := utf8.DecodeRuneInString(name)
+	if r == utf8.RuneError {
+		return "r"
+	}
+	return string(unicode.ToLower(r))
+}
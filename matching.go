@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"unicode"
+)
+
+//-------------------------------------------------------------------------
+// candidate matching
+//
+// Filters candidates by the partial input and gives them a score, candidates
+// with higher scores go first. See the "matcher" config option.
+//-------------------------------------------------------------------------
+
+const (
+	score_match       = 16 // every matched character
+	score_word_start  = 24 // matched character starts a word (hump)
+	score_name_start  = 32 // matched character starts a name
+	score_consecutive = 16 // matched character follows the previous one
+	score_exact_case  = 4  // matched character has the same case
+	score_prefix      = 64 // the whole partial input is a prefix
+	score_exact       = 64 // the whole name matches, on top of score_prefix
+
+	score_none = -1 << 31
+)
+
+// Returns the score of 'name' for the 'partial' input and whether it matches
+// at all. With the "prefix" matcher all matching candidates score equally.
+// The fuzzy matchers are always case-insensitive, 'ignorecase' is for the
+// "prefix" one.
+func match_candidate(name, partial string, ignorecase bool) (int, bool) {
+	switch g_config.Matcher {
+	case "fuzzy":
+		return fuzzy_match(name, partial, false)
+	case "camelcase":
+		return fuzzy_match(name, partial, true)
+	}
+	return 0, has_prefix(name, partial, ignorecase)
+}
+
+// Checks if 'partial' is a subsequence of 'name' (case-insensitively) and
+// finds the best scoring way to match it. In camel case mode every non
+// consecutive match has to start a word: "nrw" matches "NewReadWriter", but
+// not "Narrow".
+func fuzzy_match(name, partial string, camelcase bool) (int, bool) {
+	if partial == "" {
+		return 0, true
+	}
+	n := []rune(name)
+	p := []rune(partial)
+	if len(p) > len(n) {
+		return 0, false
+	}
+
+	// best[j] is the best score of matching p[:i+1] with p[i] matched at
+	// n[j], computed row by row
+	best := make([]int, len(n))
+	prev := make([]int, len(n))
+	for i := range p {
+		best, prev = prev, best
+		// max(prev[k] + k) for k < j-1, the gap from k to j costs j-k-1
+		gap := score_none
+		for j := range n {
+			if j >= 2 && prev[j-2] != score_none && prev[j-2]+j-2 > gap {
+				gap = prev[j-2] + j - 2
+			}
+			best[j] = score_none
+			if j < i || unicode.ToLower(p[i]) != unicode.ToLower(n[j]) {
+				continue
+			}
+
+			word_start := is_word_start(n, j)
+			s := score_match
+			switch {
+			case j == 0:
+				s += score_name_start
+			case word_start:
+				s += score_word_start
+			}
+			if p[i] == n[j] {
+				s += score_exact_case
+			}
+
+			if i == 0 {
+				if !camelcase || word_start {
+					// skipped characters cost twice as much at the
+					// beginning
+					best[j] = s - 2*j
+				}
+				continue
+			}
+			if j >= 1 && prev[j-1] != score_none {
+				best[j] = prev[j-1] + s + score_consecutive
+			}
+			if gap != score_none && (!camelcase || word_start) {
+				if v := gap + 1 - j + s; v > best[j] {
+					best[j] = v
+				}
+			}
+		}
+	}
+
+	score := score_none
+	for _, s := range best {
+		if s > score {
+			score = s
+		}
+	}
+	if score == score_none {
+		return 0, false
+	}
+	if has_prefix(name, partial, true) {
+		score += score_prefix
+		if len(n) == len(p) {
+			score += score_exact
+		}
+	}
+	// shorter names are more likely to be the ones we want
+	return score - (len(n) - len(p)), true
+}
+
+// Word starts are: the beginning of the name, an upper case letter after a
+// lower case letter or a digit, the last upper case letter of an acronym
+// followed by a lower case letter ("HTTPServer"), a letter or a digit after
+// an underscore and a digit after a letter.
+func is_word_start(n []rune, j int) bool {
+	if j == 0 {
+		return true
+	}
+	c, prev := n[j], n[j-1]
+	switch {
+	case prev == '_':
+		return c != '_'
+	case unicode.IsUpper(c):
+		if !unicode.IsUpper(prev) {
+			return true
+		}
+		return j+1 < len(n) && unicode.IsLower(n[j+1])
+	case unicode.IsDigit(c):
+		return !unicode.IsDigit(prev)
+	}
+	return false
+}
+
+//-------------------------------------------------------------------------
+// expected type matching
+//
+// Candidates assignable to the type expected at the cursor position go
+// first, see deduce_expected_type.
+//-------------------------------------------------------------------------
+
+// Checks if the candidate's value (or the result of calling it, for
+// functions) is assignable to the expected type. The check is approximate,
+// interfaces are matched by method names only.
+func (b *out_buffers) matches_expected_type(d *decl) bool {
+	if b.expected == nil {
+		return false
+	}
+	switch d.class {
+	case decl_const, decl_var, decl_func:
+	default:
+		return false
+	}
+
+	t, s := d.infer_type()
+	if t == nil {
+		return false
+	}
+	if d.class == decl_func {
+		ft, ok := t.(*ast.FuncType)
+		if !ok || ft.TypeParams != nil || ft.Results == nil || len(ft.Results.List) != 1 || len(ft.Results.List[0].Names) > 1 {
+			return false
+		}
+		t = ft.Results.List[0].Type
+	}
+	return b.assignable(t, s, b.expected, b.expected_scope)
+}
+
+func (b *out_buffers) assignable(t ast.Expr, ts *scope, e ast.Expr, es *scope) bool {
+	if b.type_string(t) == b.type_string(e) {
+		return true
+	}
+
+	td := named_type_decl(t, ts)
+	ed := named_type_decl(e, es)
+	if td != nil && td == ed {
+		return true
+	}
+	if ed != nil {
+		if id := advance_to_struct_or_interface(ed); id != nil {
+			if _, ok := id.typ.(*ast.InterfaceType); ok {
+				return implements(t, ts, id)
+			}
+		}
+	}
+
+	// values of named types are assignable to type literals with the same
+	// underlying type and the other way around
+	switch {
+	case td != nil && ed == nil:
+		return b.type_string(td.typ) == b.type_string(e)
+	case td == nil && ed != nil:
+		return b.type_string(t) == b.type_string(ed.typ)
+	}
+	return false
+}
+
+func (b *out_buffers) type_string(e ast.Expr) string {
+	var buf bytes.Buffer
+	pretty_print_type_expr(&buf, e, b.canonical_aliases)
+	return buf.String()
+}
+
+// Returns the declaration of a named type, nil for type literals.
+func named_type_decl(t ast.Expr, s *scope) *decl {
+	switch t.(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+	default:
+		return nil
+	}
+	d := type_to_decl(t, s)
+	if d == nil || d.class != decl_type {
+		return nil
+	}
+	if d.is_alias() {
+		return d.type_dealias()
+	}
+	return d
+}
+
+// An empty interface is implemented by everything, which is not much of a
+// match, so it doesn't count.
+func implements(t ast.Expr, s *scope, iface *decl) bool {
+	methods := make(map[string]bool)
+	interface_methods(iface, methods)
+	if len(methods) == 0 {
+		return false
+	}
+	d := type_to_decl(t, s)
+	if d == nil {
+		return false
+	}
+	for name := range methods {
+		if d.find_child_and_in_embedded(name) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func interface_methods(d *decl, methods map[string]bool) {
+	if d == nil || d.is_visited() {
+		return
+	}
+	d.set_visited()
+	defer d.clear_visited()
+
+	for name := range d.children {
+		methods[name] = true
+	}
+	for _, e := range d.embedded {
+		if ed := type_to_decl(e, d.scope); ed != nil {
+			interface_methods(advance_to_struct_or_interface(ed), methods)
+		}
+	}
+}
@@ -4,7 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -16,11 +24,12 @@ type package_parser interface {
 // package_file_cache
 //
 // Structure that represents a cache for an imported pacakge. In other words
-// these are the contents of an archive (*.a) file.
+// these are the contents of an archive (*.a) file. If there is no archive,
+// the package is loaded from its source code directory instead.
 //-------------------------------------------------------------------------
 
 type package_file_cache struct {
-	name        string // file name
+	name        string // file name or source directory name
 	import_name string
 	mtime       int64
 	defalias    string
@@ -28,6 +37,27 @@ type package_file_cache struct {
 	scope  *scope
 	main   *decl // package declaration
 	others map[string]*decl
+
+	// source packages only, unlike archives they are not self-contained
+	// and refer to the packages they import
+	source bool
+	tests  bool // in-package test files are included as well
+	files  []package_source_file
+
+	// archives only, doc comments are read from the source directory
+	comments bool
+
+	// archives only, positions read from the export data, see add_pos
+	positions []token.Position
+}
+
+// A package under test, imported by an external test package, is the source
+// code directory name followed by this suffix.
+const g_test_package_suffix = " [test]"
+
+type package_source_file struct {
+	filescope *scope
+	packages  []package_import
 }
 
 func new_package_file_cache(absname, name string) *package_file_cache {
@@ -36,6 +66,8 @@ func new_package_file_cache(absname, name string) *package_file_cache {
 	m.import_name = name
 	m.mtime = 0
 	m.defalias = ""
+	m.tests = strings.HasSuffix(absname, g_test_package_suffix)
+	m.source = m.tests || is_dir(absname)
 	return m
 }
 
@@ -75,6 +107,10 @@ func (m *package_file_cache) update_cache() {
 	if m.mtime == -1 {
 		return
 	}
+	if m.source {
+		m.update_source_cache()
+		return
+	}
 	fname := m.find_file()
 	stat, err := os.Stat(fname)
 	if err != nil {
@@ -95,6 +131,9 @@ func (m *package_file_cache) update_cache() {
 
 func (m *package_file_cache) process_package_data(data []byte) {
 	m.scope = new_named_scope(g_universe_scope, m.name)
+	m.scope.position = m.position
+	m.comments = false
+	m.positions = nil
 
 	// find import section
 	i := bytes.Index(data, []byte{'\n', '$', '$'})
@@ -116,6 +155,10 @@ func (m *package_file_cache) process_package_data(data []byte) {
 			var p gc_ibin_parser
 			p.init(data[1:], m)
 			pp = &p
+		} else if len(data) > 0 && data[0] == 'u' {
+			var p gc_ubin_parser
+			p.init(data[1:], m)
+			pp = &p
 		} else {
 			var p gc_bin_parser
 			p.init(data, m)
@@ -166,11 +209,446 @@ func (m *package_file_cache) process_package_data(data []byte) {
 	}
 }
 
+// Parses non-test Go files of a package directory and fills the cache with
+// their exported declarations. Imports of these files are resolved later on,
+// see fixup_imports.
+func (m *package_file_cache) update_source_cache() {
+	dir := strings.TrimSuffix(m.name, g_test_package_suffix)
+
+	// any file change bumps modification time of the file itself, adding
+	// or removing files bumps modification time of the directory
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return
+	}
+	mtime := stat.ModTime().UnixNano()
+	fis, err := readdir_lstat(dir)
+	if err != nil {
+		return
+	}
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), ".go") && fi.ModTime().UnixNano() > mtime {
+			mtime = fi.ModTime().UnixNano()
+		}
+	}
+	if m.mtime == mtime {
+		return
+	}
+	m.mtime = mtime
+
+	context := &g_daemon.context
+	pkg, err := context.ImportDir(dir, 0)
+	if pkg == nil || pkg.Name == "" {
+		if *g_debug {
+			log.Printf("Failed to load package sources from %q: %s\n", dir, err)
+		}
+		return
+	}
+
+	fset := token.NewFileSet()
+	m.scope = new_named_scope(g_universe_scope, m.name)
+	m.scope.position = fset.Position
+	m.main = new_decl(m.name, decl_package, nil)
+	m.others = nil
+	m.defalias = pkg.Name
+	m.files = m.files[:0]
+
+	var filenames []string
+	var files []*ast.File
+	names := append(pkg.GoFiles, pkg.CgoFiles...)
+	if m.tests {
+		names = append(names, pkg.TestGoFiles...)
+	}
+	for _, name := range names {
+		filename := filepath.Join(dir, name)
+		data, err := file_reader.read_file(filename)
+		if err != nil {
+			continue
+		}
+		data, _ = filter_out_shebang(data)
+		file, _ := parser.ParseFile(fset, filename, data, parser.SkipObjectResolution|doc_parser_mode())
+		if file == nil {
+			continue
+		}
+		filenames = append(filenames, filename)
+		files = append(files, file)
+	}
+
+	// package level types are referred to the same way archives do it:
+	// "!<dir>!<name>.Type", this way they are printed with the package
+	// name and make sense outside of the package
+	mainName := "!" + m.name + "!" + m.defalias
+	q := source_qualifier{pkg: mainName, names: make(map[string]bool)}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.TYPE {
+				for _, spec := range gd.Specs {
+					q.names[spec.(*ast.TypeSpec).Name.Name] = true
+				}
+			}
+		}
+	}
+
+	// unexported declarations are not a part of the package, but types of
+	// exported ones may depend on them
+	private := make(map[string]*decl)
+	for i, file := range files {
+		f := package_source_file{filescope: new_scope(m.scope)}
+		f.packages = collect_package_imports(filenames[i], file.Decls, context)
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				fd.Body = nil
+			}
+			q.decl(decl)
+			anonymify_ast(decl, decl_foreign, f.filescope)
+			add_ast_decl_to_package(m.main, decl, f.filescope)
+			append_to_top_decls(private, decl, f.filescope)
+		}
+		m.files = append(m.files, f)
+	}
+
+	// declarations refer to each other without package qualifiers as well
+	for name, d := range private {
+		if !ast.IsExported(name) && d.class != decl_type && d.class != decl_methods_stub {
+			m.scope.add_decl(name, d)
+		}
+	}
+	for name, d := range m.main.children {
+		m.scope.add_decl(name, d)
+	}
+	m.scope.add_decl(mainName, m.main)
+}
+
+// Makes imported packages of a source package visible in its file scopes.
+func (m *package_file_cache) fixup_imports(pcache package_cache) {
+	for _, f := range m.files {
+		fixup_packages(f.filescope, f.packages, pcache)
+	}
+}
+
 func (m *package_file_cache) add_package_to_scope(alias, realname string) {
 	d := new_decl(realname, decl_package, nil)
 	m.scope.add_decl(alias, d)
 }
 
+// Records a position read from the export data, the result stands for it in
+// the AST built by the parser. File names may be relative to $GOROOT.
+func (m *package_file_cache) add_pos(filename string, line, column int) token.Pos {
+	if filename == "" || line <= 0 {
+		return token.NoPos
+	}
+	if strings.HasPrefix(filename, "$GOROOT") {
+		filename = filepath.Join(g_daemon.context.GOROOT, filename[len("$GOROOT"):])
+	}
+	m.positions = append(m.positions, token.Position{
+		Filename: filename,
+		Line:     line,
+		Column:   column,
+	})
+	return token.Pos(len(m.positions))
+}
+
+func (m *package_file_cache) position(p token.Pos) token.Position {
+	if p <= 0 || int(p) > len(m.positions) {
+		return token.Position{}
+	}
+	return m.positions[p-1]
+}
+
+//-------------------------------------------------------------------------
+// source_qualifier
+//
+// Rewrites references to package level types in declarations of a source
+// package to qualified ones.
+//-------------------------------------------------------------------------
+
+type source_qualifier struct {
+	pkg   string
+	names map[string]bool
+}
+
+// type parameters shadow package level types
+func (q source_qualifier) without(lists ...*ast.FieldList) source_qualifier {
+	shadowed := false
+	for _, fl := range lists {
+		if fl == nil {
+			continue
+		}
+		for _, field := range fl.List {
+			for _, name := range field.Names {
+				if !q.names[name.Name] {
+					continue
+				}
+				if !shadowed {
+					names := make(map[string]bool, len(q.names))
+					for k, v := range q.names {
+						names[k] = v
+					}
+					q.names = names
+					shadowed = true
+				}
+				delete(q.names, name.Name)
+			}
+		}
+	}
+	return q
+}
+
+func (q source_qualifier) decl(d ast.Decl) {
+	switch t := d.(type) {
+	case *ast.GenDecl:
+		for _, spec := range t.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				q := q.without(s.TypeParams)
+				q.fields(s.TypeParams)
+				s.Type = q.expr(s.Type)
+			case *ast.ValueSpec:
+				if s.Type == nil && t.Tok == token.VAR {
+					s.Type = default_literal_type(s.Values)
+				}
+				s.Type = q.expr(s.Type)
+				for i, v := range s.Values {
+					s.Values[i] = q.expr(v)
+				}
+			}
+		}
+	case *ast.FuncDecl:
+		q = q.without(t.Type.TypeParams, ast_decl_type_params(t))
+		q.fields(t.Type.TypeParams)
+		q.fields(t.Type.Params)
+		q.fields(t.Type.Results)
+	}
+}
+
+// Parameters are split one per field, the way they look in export data.
+func (q source_qualifier) fields(fl *ast.FieldList) {
+	if fl == nil {
+		return
+	}
+	list := make([]*ast.Field, 0, len(fl.List))
+	for _, field := range fl.List {
+		field.Type = q.expr(field.Type)
+		if len(field.Names) < 2 {
+			list = append(list, field)
+			continue
+		}
+		for _, name := range field.Names {
+			list = append(list, &ast.Field{
+				Names: []*ast.Ident{name},
+				Type:  field.Type,
+				Tag:   field.Tag,
+			})
+		}
+	}
+	fl.List = list
+}
+
+// Export data has types for all variables, source code doesn't, the most
+// common case is literals, figure out their default type.
+func default_literal_type(values []ast.Expr) ast.Expr {
+	kind := token.ILLEGAL
+	for _, v := range values {
+		lit, ok := v.(*ast.BasicLit)
+		if !ok || (kind != token.ILLEGAL && kind != lit.Kind) {
+			return nil
+		}
+		kind = lit.Kind
+	}
+	switch kind {
+	case token.INT:
+		return ast.NewIdent("int")
+	case token.FLOAT:
+		return ast.NewIdent("float64")
+	case token.IMAG:
+		return ast.NewIdent("complex128")
+	case token.CHAR:
+		return ast.NewIdent("rune")
+	case token.STRING:
+		return ast.NewIdent("string")
+	}
+	return nil
+}
+
+// Export data has values of constants, turn them into expressions which are
+// stored as the values of constant declarations.
+func constant_to_expr(v constant.Value) ast.Expr {
+	switch v.Kind() {
+	case constant.Bool:
+		return ast.NewIdent(v.String())
+	case constant.Int, constant.Float:
+		if constant.Sign(v) < 0 {
+			return &ast.UnaryExpr{Op: token.SUB, X: constant_to_expr(constant.UnaryOp(token.SUB, v, 0))}
+		}
+		if v.Kind() == constant.Int {
+			return &ast.BasicLit{Kind: token.INT, Value: v.ExactString()}
+		}
+		lit := v.String()
+		if f, _ := constant.Float64Val(v); !math.IsInf(f, 0) {
+			lit = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return &ast.BasicLit{Kind: token.FLOAT, Value: lit}
+	case constant.String:
+		return &ast.BasicLit{Kind: token.STRING, Value: v.ExactString()}
+	case constant.Complex:
+		op, im := token.ADD, constant.Imag(v)
+		if constant.Sign(im) < 0 {
+			op, im = token.SUB, constant.UnaryOp(token.SUB, im, 0)
+		}
+		lit := constant_to_expr(im).(*ast.BasicLit)
+		return &ast.BinaryExpr{
+			X:  constant_to_expr(constant.Real(v)),
+			Op: op,
+			Y:  &ast.BasicLit{Kind: token.IMAG, Value: lit.Value + "i"},
+		}
+	}
+	return &ast.BadExpr{}
+}
+
+func (q source_qualifier) expr(e ast.Expr) ast.Expr {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if q.names[t.Name] {
+			return &ast.SelectorExpr{X: ast.NewIdent(q.pkg), Sel: t}
+		}
+	case *ast.StarExpr:
+		t.X = q.expr(t.X)
+	case *ast.ParenExpr:
+		t.X = q.expr(t.X)
+	case *ast.UnaryExpr:
+		t.X = q.expr(t.X)
+	case *ast.BinaryExpr:
+		t.X = q.expr(t.X)
+		t.Y = q.expr(t.Y)
+	case *ast.SelectorExpr:
+		// method expressions
+		t.X = q.expr(t.X)
+	case *ast.ArrayType:
+		t.Elt = q.expr(t.Elt)
+	case *ast.Ellipsis:
+		t.Elt = q.expr(t.Elt)
+	case *ast.MapType:
+		t.Key = q.expr(t.Key)
+		t.Value = q.expr(t.Value)
+	case *ast.ChanType:
+		t.Value = q.expr(t.Value)
+	case *ast.FuncType:
+		q = q.without(t.TypeParams)
+		q.fields(t.TypeParams)
+		q.fields(t.Params)
+		q.fields(t.Results)
+	case *ast.FuncLit:
+		q.expr(t.Type)
+	case *ast.StructType:
+		q.fields(t.Fields)
+	case *ast.InterfaceType:
+		q.fields(t.Methods)
+	case *ast.IndexExpr:
+		t.X = q.expr(t.X)
+		t.Index = q.expr(t.Index)
+	case *ast.IndexListExpr:
+		t.X = q.expr(t.X)
+		for i, index := range t.Indices {
+			t.Indices[i] = q.expr(index)
+		}
+	case *ast.CompositeLit:
+		t.Type = q.expr(t.Type)
+	case *ast.CallExpr:
+		// conversions and calls of generic functions
+		t.Fun = q.expr(t.Fun)
+		for i, arg := range t.Args {
+			t.Args[i] = q.expr(arg)
+		}
+	}
+	return e
+}
+
+// Archives have no doc comments, reads them from the package source
+// directory, once per archive update.
+func (m *package_file_cache) load_comments() {
+	if m.source || m.comments || m.main == nil {
+		return
+	}
+	m.comments = true
+
+	context := &g_daemon.context
+	dir := strings.TrimSuffix(m.name, ".a")
+	if !strings.HasPrefix(m.import_name, ".") || !is_dir(dir) {
+		p, err := context.Import(m.import_name, "", build.FindOnly)
+		if err != nil {
+			return
+		}
+		dir = p.Dir
+	}
+	pkg, err := context.ImportDir(dir, 0)
+	if pkg == nil || pkg.Name == "" {
+		if *g_debug {
+			log.Printf("Failed to load doc comments from %q: %s\n", dir, err)
+		}
+		return
+	}
+	for _, name := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		data, err := file_reader.read_file(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		data, _ = filter_out_shebang(data)
+		file, _ := parser.ParseFile(token.NewFileSet(), "", data, parser.SkipObjectResolution|parser.ParseComments)
+		if file == nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			add_ast_decl_comments(m.main, decl)
+		}
+	}
+}
+
+// Attaches doc comments of the declaration to the package's decls, struct
+// fields and interface methods included.
+func add_ast_decl_comments(pkg *decl, decl ast.Decl) {
+	if !ast_decl_convertable(decl) {
+		return
+	}
+	for _, decl := range ast_decl_split(decl) {
+		doc := ast_decl_doc(decl)
+		for _, name := range ast_decl_names(decl) {
+			d := pkg.children[name.Name]
+			if methodof := method_of(decl); methodof != "" {
+				d = nil
+				if t := pkg.children[methodof]; t != nil {
+					d = t.children[name.Name]
+				}
+			}
+			if d == nil {
+				continue
+			}
+			d.set_doc(doc)
+
+			var fields *ast.FieldList
+			switch t := ast_decl_type(decl).(type) {
+			case *ast.StructType:
+				fields = t.Fields
+			case *ast.InterfaceType:
+				fields = t.Methods
+			}
+			if fields == nil {
+				continue
+			}
+			for _, f := range fields.List {
+				names := f.Names
+				if names == nil {
+					names = []*ast.Ident{ast.NewIdent(get_type_path(f.Type).name)}
+				}
+				for _, n := range names {
+					if c := d.children[n.Name]; c != nil {
+						c.set_doc(ast_field_doc(f))
+					}
+				}
+			}
+		}
+	}
+}
+
 func add_ast_decl_to_package(pkg *decl, decl ast.Decl, scope *scope) {
 	foreach_decl(decl, func(data *foreach_decl_struct) {
 		class := ast_decl_class(data.decl)
@@ -181,6 +659,10 @@ func add_ast_decl_to_package(pkg *decl, decl ast.Decl, scope *scope) {
 			if d == nil {
 				return
 			}
+			d.tparams = ast_decl_type_params(data.decl)
+			d.set_doc(ast_decl_doc(data.decl))
+			d.set_pos(name.Pos())
+			d.const_value = data.const_value(i)
 
 			if !name.IsExported() && d.class != decl_type {
 				return
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"strconv"
 	"strings"
@@ -200,55 +201,57 @@ func (p *gc_bin_parser) pkg() string {
 func (p *gc_bin_parser) obj(tag int) {
 	switch tag {
 	case constTag:
-		p.pos()
+		pos := p.pos()
 		pkg, name := p.qualifiedName()
 		typ := p.typ("")
-		p.skipValue() // ignore const value, gocode's not interested
+		val := p.value()
 		p.callback(pkg, &ast.GenDecl{
 			Tok: token.CONST,
 			Specs: []ast.Spec{
 				&ast.ValueSpec{
-					Names:  []*ast.Ident{ast.NewIdent(name)},
+					Names:  []*ast.Ident{{NamePos: pos, Name: name}},
 					Type:   typ,
-					Values: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0"}},
+					Values: []ast.Expr{constant_to_expr(val)},
 				},
 			},
 		})
 
 	case aliasTag:
 		// TODO(gri) verify type alias hookup is correct
-		p.pos()
+		pos := p.pos()
 		pkg, name := p.qualifiedName()
 		typ := p.typ("")
+		spec := typeAliasSpec(name, typ)
+		spec.Name.NamePos = pos
 		p.callback(pkg, &ast.GenDecl{
 			Tok:   token.TYPE,
-			Specs: []ast.Spec{typeAliasSpec(name, typ)},
+			Specs: []ast.Spec{spec},
 		})
 
 	case typeTag:
 		_ = p.typ("")
 
 	case varTag:
-		p.pos()
+		pos := p.pos()
 		pkg, name := p.qualifiedName()
 		typ := p.typ("")
 		p.callback(pkg, &ast.GenDecl{
 			Tok: token.VAR,
 			Specs: []ast.Spec{
 				&ast.ValueSpec{
-					Names: []*ast.Ident{ast.NewIdent(name)},
+					Names: []*ast.Ident{{NamePos: pos, Name: name}},
 					Type:  typ,
 				},
 			},
 		})
 
 	case funcTag:
-		p.pos()
+		pos := p.pos()
 		pkg, name := p.qualifiedName()
 		params := p.paramList()
 		results := p.paramList()
 		p.callback(pkg, &ast.FuncDecl{
-			Name: ast.NewIdent(name),
+			Name: &ast.Ident{NamePos: pos, Name: name},
 			Type: &ast.FuncType{Params: params, Results: results},
 		})
 
@@ -259,9 +262,9 @@ func (p *gc_bin_parser) obj(tag int) {
 
 const deltaNewFile = -64 // see cmd/compile/internal/gc/bexport.go
 
-func (p *gc_bin_parser) pos() {
+func (p *gc_bin_parser) pos() token.Pos {
 	if !p.posInfoFormat {
-		return
+		return token.NoPos
 	}
 
 	file := p.prevFile
@@ -288,7 +291,7 @@ func (p *gc_bin_parser) pos() {
 	p.prevFile = file
 	p.prevLine = line
 
-	// TODO(gri) register new position
+	return p.pfc.add_pos(file, line, 0)
 }
 
 func (p *gc_bin_parser) qualifiedName() (pkg string, name string) {
@@ -333,13 +336,13 @@ func (p *gc_bin_parser) typ(parent string) ast.Expr {
 	switch i {
 	case namedTag:
 		// read type object
-		p.pos()
+		pos := p.pos()
 		parent, name := p.qualifiedName()
 		tdecl := &ast.GenDecl{
 			Tok: token.TYPE,
 			Specs: []ast.Spec{
 				&ast.TypeSpec{
-					Name: ast.NewIdent(name),
+					Name: &ast.Ident{NamePos: pos, Name: name},
 				},
 			},
 		}
@@ -362,7 +365,7 @@ func (p *gc_bin_parser) typ(parent string) ast.Expr {
 		// read associated methods
 		for i := p.int(); i > 0; i-- {
 			// TODO(gri) replace this with something closer to fieldName
-			p.pos()
+			pos := p.pos()
 			name := p.string()
 			if !exported(name) {
 				p.pkg()
@@ -376,7 +379,7 @@ func (p *gc_bin_parser) typ(parent string) ast.Expr {
 			strip_method_receiver(recv)
 			p.callback(parent, &ast.FuncDecl{
 				Recv: recv,
-				Name: ast.NewIdent(name),
+				Name: &ast.Ident{NamePos: pos, Name: name},
 				Type: &ast.FuncType{Params: params, Results: results},
 			})
 		}
@@ -469,14 +472,14 @@ func (p *gc_bin_parser) structType(parent string) *ast.StructType {
 }
 
 func (p *gc_bin_parser) field(parent string) (*ast.Field, string) {
-	p.pos()
+	pos := p.pos()
 	_, name, _ := p.fieldName(parent)
 	typ := p.typ(parent)
 	tag := p.string()
 
 	var names []*ast.Ident
 	if name != "" {
-		names = []*ast.Ident{ast.NewIdent(name)}
+		names = []*ast.Ident{{NamePos: pos, Name: name}}
 	}
 	return &ast.Field{
 		Names: names,
@@ -495,12 +498,12 @@ func (p *gc_bin_parser) methodList(parent string) (methods []*ast.Field) {
 }
 
 func (p *gc_bin_parser) method(parent string) *ast.Field {
-	p.pos()
+	pos := p.pos()
 	_, name, _ := p.fieldName(parent)
 	params := p.paramList()
 	results := p.paramList()
 	return &ast.Field{
-		Names: []*ast.Ident{ast.NewIdent(name)},
+		Names: []*ast.Ident{{NamePos: pos, Name: name}},
 		Type:  &ast.FuncType{Params: params, Results: results},
 	}
 }
@@ -583,31 +586,68 @@ func exported(name string) bool {
 	return unicode.IsUpper(ch)
 }
 
-func (p *gc_bin_parser) skipValue() {
+func (p *gc_bin_parser) value() constant.Value {
 	switch tag := p.tagOrIndex(); tag {
-	case falseTag, trueTag:
+	case falseTag:
+		return constant.MakeBool(false)
+	case trueTag:
+		return constant.MakeBool(true)
 	case int64Tag:
-		p.int64()
+		return constant.MakeInt64(p.int64())
 	case floatTag:
-		p.float()
+		return p.float()
 	case complexTag:
-		p.float()
-		p.float()
+		re := p.float()
+		im := p.float()
+		return constant.BinaryOp(re, token.ADD, constant.MakeImag(im))
 	case stringTag:
-		p.string()
+		return constant.MakeString(p.string())
 	default:
 		panic(fmt.Sprintf("unexpected value tag %d", tag))
 	}
 }
 
-func (p *gc_bin_parser) float() {
+func (p *gc_bin_parser) float() constant.Value {
 	sign := p.int()
 	if sign == 0 {
-		return
+		return constant.MakeInt64(0)
+	}
+
+	exp := p.int()
+	mant := []byte(p.string()) // big endian
+
+	// remove leading 0's if any
+	for len(mant) > 0 && mant[0] == 0 {
+		mant = mant[1:]
+	}
+
+	// convert to little endian
+	for i, j := 0, len(mant)-1; i < j; i, j = i+1, j-1 {
+		mant[i], mant[j] = mant[j], mant[i]
+	}
+
+	// adjust exponent, mant represents the mantissa bits such that
+	// 0.5 <= mant < 1.0
+	exp -= len(mant) << 3
+	if len(mant) > 0 {
+		for msd := mant[len(mant)-1]; msd&0x80 == 0; msd <<= 1 {
+			exp++
+		}
+	}
+
+	x := constant.MakeFromBytes(mant)
+	switch {
+	case exp < 0:
+		d := constant.Shift(constant.MakeInt64(1), token.SHL, uint(-exp))
+		x = constant.BinaryOp(x, token.QUO, d)
+	case exp > 0:
+		x = constant.Shift(x, token.SHL, uint(exp))
 	}
 
-	p.int()    // exp
-	p.string() // mant
+	if sign < 0 {
+		x = constant.UnaryOp(token.SUB, x, 0)
+	}
+	return x
 }
 
 // ----------------------------------------------------------------------------
@@ -826,4 +866,10 @@ var predeclared = []ast.Expr{
 
 	// used internally by gc; never used by this package or in .a files
 	ast.NewIdent("any"),
+
+	// comparable
+	ast.NewIdent("comparable"),
+
+	// any
+	ast.NewIdent("any"),
 }
@@ -133,13 +133,20 @@ func (p *gc_ibin_parser) init(data []byte, pfc *package_file_cache) {
 	p.pkgCache = make(map[uint64]ibinPackage)
 }
 
+const (
+	iexportVersionGo1_11         = 0
+	iexportVersionPosCol         = 1
+	iexportVersionGenerics       = 2
+	iexportVersionGenericMethods = 3 // x/tools only
+	iexportVersionCurrent        = iexportVersionGenericMethods
+)
+
 func (p *gc_ibin_parser) parse_export(callback func(string, ast.Decl)) {
-	const currentVersion = 0
 	p.callback = callback
 
 	r := &intReader{bytes.NewReader(p.data)}
 	p.version = int(r.uint64())
-	if p.version != currentVersion {
+	if p.version < iexportVersionGo1_11 || p.version > iexportVersionCurrent {
 		panic(fmt.Errorf("unknown export format version %d", p.version))
 	}
 
@@ -220,6 +227,9 @@ func (p *gc_ibin_parser) doDecl(pkg ibinPackage, name string) *ibinType {
 type ibinType struct {
 	typ ast.Expr
 	und *ibinType
+
+	// constraint of a type parameter
+	constraint ast.Expr
 }
 
 func (t *ibinType) underlying() ast.Expr {
@@ -233,52 +243,71 @@ type importReader struct {
 	p          *gc_ibin_parser
 	declReader bytes.Reader
 	currPkg    ibinPackage
+
+	prevFile   string
+	prevLine   int64
+	prevColumn int64
 }
 
 func (r *importReader) obj(name string) *ibinType {
 	tag := r.byte()
-	r.pos()
+	pos := r.pos()
 
 	switch tag {
-	case 'A':
+	case 'A', 'B':
+		if tag == 'B' {
+			r.tparamList() // generic aliases are treated as plain ones
+		}
 		typ := r.typ()
+		spec := typeAliasSpec(name, typ.typ)
+		spec.Name.NamePos = pos
 		r.p.callback(r.currPkg.fullName, &ast.GenDecl{
 			Tok:   token.TYPE,
-			Specs: []ast.Spec{typeAliasSpec(name, typ.typ)},
+			Specs: []ast.Spec{spec},
 		})
 		return typ
 	case 'C':
-		typ := r.value()
+		typ, val := r.value()
 		r.p.callback(r.currPkg.fullName, &ast.GenDecl{
 			Tok: token.CONST,
 			Specs: []ast.Spec{
 				&ast.ValueSpec{
-					Names:  []*ast.Ident{ast.NewIdent(name)},
+					Names:  []*ast.Ident{{NamePos: pos, Name: name}},
 					Type:   typ.typ,
-					Values: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0"}},
+					Values: []ast.Expr{constant_to_expr(val)},
 				},
 			},
 		})
 		return typ
-	case 'F':
+	case 'F', 'G':
+		var tparams *ast.FieldList
+		if tag == 'G' {
+			tparams = r.tparamList()
+		}
 		sig := r.signature()
+		sig.TypeParams = tparams
 		r.p.callback(r.currPkg.fullName, &ast.FuncDecl{
-			Name: ast.NewIdent(name),
+			Name: &ast.Ident{NamePos: pos, Name: name},
 			Type: sig,
 		})
 		return &ibinType{typ: sig}
-	case 'T':
+	case 'T', 'U':
 		// Types can be recursive. We need to setup a stub
 		// declaration before recursing.
 		t := &ibinType{typ: &ast.SelectorExpr{X: ast.NewIdent(r.currPkg.fullName), Sel: ast.NewIdent(name)}}
 		r.currPkg.declTyp[name] = t
+		var tparams *ast.FieldList
+		if tag == 'U' {
+			tparams = r.tparamList()
+		}
 		t.und = r.p.typAt(r.uint64())
 		r.p.callback(r.currPkg.fullName, &ast.GenDecl{
 			Tok: token.TYPE,
 			Specs: []ast.Spec{
 				&ast.TypeSpec{
-					Name: ast.NewIdent(name),
-					Type: t.und.typ,
+					Name:       &ast.Ident{NamePos: pos, Name: name},
+					TypeParams: tparams,
+					Type:       t.und.typ,
 				},
 			},
 		})
@@ -289,26 +318,44 @@ func (r *importReader) obj(name string) *ibinType {
 
 		// read associated methods
 		for n := r.uint64(); n > 0; n-- {
-			r.pos()
+			mpos := r.pos()
 			mname := r.ident()
+			var mtparams *ast.FieldList
+			if r.p.version >= iexportVersionGenericMethods && r.bool() {
+				mtparams = r.tparamList()
+			}
 			recv := &ast.FieldList{List: []*ast.Field{r.param()}}
 			msig := r.signature()
+			msig.TypeParams = mtparams
 			strip_method_receiver(recv)
 			r.p.callback(r.currPkg.fullName, &ast.FuncDecl{
 				Recv: recv,
-				Name: ast.NewIdent(mname),
+				Name: &ast.Ident{NamePos: mpos, Name: mname},
 				Type: msig,
 			})
 		}
 		return t
 
+	case 'P':
+		// Type parameters may refer to themselves in their constraints,
+		// declare them before reading the constraint. They're not
+		// package level entities, no callback here.
+		if r.p.version < iexportVersionGenerics {
+			panic("unexpected type param type")
+		}
+		t := &ibinType{typ: ast.NewIdent(tparamName(name))}
+		r.currPkg.declTyp[name] = t
+		r.bool() // implicit interface flag, don't care
+		t.constraint = r.typ().typ
+		return t
+
 	case 'V':
 		typ := r.typ()
 		r.p.callback(r.currPkg.fullName, &ast.GenDecl{
 			Tok: token.VAR,
 			Specs: []ast.Spec{
 				&ast.ValueSpec{
-					Names: []*ast.Ident{ast.NewIdent(name)},
+					Names: []*ast.Ident{{NamePos: pos, Name: name}},
 					Type:  typ.typ,
 				},
 			},
@@ -334,19 +381,52 @@ const (
 	signatureType
 	structType
 	interfaceType
+	typeParamType
+	instanceType
+	unionType
+	aliasType
 )
 
-// we don't care about that, let's just skip it
-func (r *importReader) pos() {
-	if r.int64() != deltaNewFile {
-	} else if l := r.int64(); l == -1 {
+// positions are encoded relative to the previous one read by the same reader
+func (r *importReader) pos() token.Pos {
+	if r.p.version >= iexportVersionPosCol {
+		delta := r.int64()
+		r.prevColumn += delta >> 1
+		if delta&1 != 0 {
+			delta = r.int64()
+			r.prevLine += delta >> 1
+			if delta&1 != 0 {
+				r.prevFile = r.string()
+			}
+		}
 	} else {
-		r.string()
+		if delta := r.int64(); delta != deltaNewFile {
+			r.prevLine += delta
+		} else if l := r.int64(); l == -1 {
+			r.prevLine += deltaNewFile
+		} else {
+			r.prevFile = r.string()
+			r.prevLine = l
+		}
 	}
+	return r.p.pfc.add_pos(r.prevFile, int(r.prevLine), int(r.prevColumn))
 }
 
-func (r *importReader) value() *ibinType {
+// Type parameter names are made unique by prefixing them with the names of
+// their declarations: "List.T", blank ones are renamed to "$<index>".
+func tparamName(exportName string) string {
+	name := exportName[strings.LastIndex(exportName, ".")+1:]
+	if strings.HasPrefix(name, "$") {
+		return "_"
+	}
+	return name
+}
+
+func (r *importReader) value() (*ibinType, constant.Value) {
 	t := r.typ()
+	if r.p.version >= iexportVersionGenerics {
+		r.int64() // constant kind
+	}
 	typ := t.underlying()
 	ident, ok := typ.(*ast.Ident)
 	if !ok {
@@ -355,21 +435,21 @@ func (r *importReader) value() *ibinType {
 
 	switch ident.Name {
 	case "bool", "&untypedBool&":
-		r.bool()
+		return t, constant.MakeBool(r.bool())
 	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16",
 		"uint32", "uint64", "uintptr", "byte", "rune", "&untypedInt&", "&untypedRune&":
-		r.mpint(ident)
+		return t, r.mpint(ident)
 	case "float32", "float64", "&untypedFloat&":
-		r.mpfloat(ident)
+		return t, r.mpfloat(ident)
 	case "complex64", "complex128", "&untypedComplex&":
-		r.mpfloat(ident)
-		r.mpfloat(ident)
+		re := r.mpfloat(ident)
+		im := r.mpfloat(ident)
+		return t, constant.BinaryOp(re, token.ADD, constant.MakeImag(im))
 	case "string", "&untypedString&":
-		r.string()
+		return t, constant.MakeString(r.string())
 	default:
 		panic(fmt.Sprintf("unexpected type: %v", typ))
 	}
-	return t
 }
 
 func intSize(typ *ast.Ident) (signed bool, maxBytes uint) {
@@ -450,12 +530,21 @@ func (r *importReader) mpint(typ *ast.Ident) constant.Value {
 	return x
 }
 
-func (r *importReader) mpfloat(typ *ast.Ident) {
+func (r *importReader) mpfloat(typ *ast.Ident) constant.Value {
 	x := r.mpint(typ)
 	if constant.Sign(x) == 0 {
-		return
+		return x
+	}
+
+	exp := r.int64()
+	switch {
+	case exp > 0:
+		x = constant.ToFloat(constant.Shift(x, token.SHL, uint(exp)))
+	case exp < 0:
+		d := constant.Shift(constant.MakeInt64(1), token.SHL, uint(-exp))
+		x = constant.BinaryOp(x, token.QUO, d)
 	}
-	r.int64()
+	return x
 }
 
 func (r *importReader) doType() *ibinType {
@@ -463,7 +552,7 @@ func (r *importReader) doType() *ibinType {
 	switch k {
 	default:
 		panic(fmt.Sprintf("unexpected kind tag: %v", k))
-	case definedType:
+	case definedType, aliasType:
 		pkg, name := r.qualifiedIdent()
 		r.p.doDecl(pkg, name)
 		return pkg.declTyp[name]
@@ -507,14 +596,14 @@ func (r *importReader) doType() *ibinType {
 
 		fields := make([]*ast.Field, r.uint64())
 		for i := range fields {
-			r.pos()
+			fpos := r.pos()
 			fname := r.ident()
 			ftyp := r.typ()
 			emb := r.bool()
 			r.string()
 			var names []*ast.Ident
 			if fname != "" && !emb {
-				names = []*ast.Ident{ast.NewIdent(fname)}
+				names = []*ast.Ident{{NamePos: fpos, Name: fname}}
 			}
 			fields[i] = &ast.Field{Names: names, Type: ftyp.typ}
 		}
@@ -524,22 +613,23 @@ func (r *importReader) doType() *ibinType {
 		r.currPkg = r.pkg()
 
 		numEmbeds := int(r.uint64())
-		embeddeds := make([]*ast.SelectorExpr, 0, numEmbeds)
+		embeddeds := make([]ast.Expr, 0, numEmbeds)
 		for i := 0; i < numEmbeds; i++ {
 			r.pos()
 			t := r.typ()
-			if named, ok := t.typ.(*ast.SelectorExpr); ok {
+			switch named := t.typ.(type) {
+			case *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
 				embeddeds = append(embeddeds, named)
 			}
 		}
 
 		methods := make([]*ast.Field, r.uint64())
 		for i := range methods {
-			r.pos()
+			mpos := r.pos()
 			mname := r.ident()
 			msig := r.signature()
 			methods[i] = &ast.Field{
-				Names: []*ast.Ident{ast.NewIdent(mname)},
+				Names: []*ast.Ident{{NamePos: mpos, Name: mname}},
 				Type:  msig,
 			}
 		}
@@ -548,9 +638,57 @@ func (r *importReader) doType() *ibinType {
 		}
 
 		return &ibinType{typ: &ast.InterfaceType{Methods: &ast.FieldList{List: methods}}}
+
+	case typeParamType:
+		pkg, name := r.qualifiedIdent()
+		return r.p.doDecl(pkg, name)
+
+	case instanceType:
+		r.pos()
+		targs := make([]ast.Expr, r.uint64())
+		for i := range targs {
+			targs[i] = r.typ().typ
+		}
+		base := r.typ()
+		if len(targs) == 1 {
+			return &ibinType{typ: &ast.IndexExpr{X: base.typ, Index: targs[0]}, und: base}
+		}
+		return &ibinType{typ: &ast.IndexListExpr{X: base.typ, Indices: targs}, und: base}
+
+	case unionType:
+		var union ast.Expr
+		for n := r.uint64(); n > 0; n-- {
+			tilde := r.bool()
+			term := r.typ().typ
+			if tilde {
+				term = &ast.UnaryExpr{Op: token.TILDE, X: term}
+			}
+			if union == nil {
+				union = term
+			} else {
+				union = &ast.BinaryExpr{X: union, Op: token.OR, Y: term}
+			}
+		}
+		return &ibinType{typ: union}
 	}
 }
 
+func (r *importReader) tparamList() *ast.FieldList {
+	n := r.uint64()
+	if n == 0 {
+		return nil
+	}
+	xs := make([]*ast.Field, n)
+	for i := range xs {
+		t := r.typ()
+		xs[i] = &ast.Field{
+			Names: []*ast.Ident{t.typ.(*ast.Ident)},
+			Type:  t.constraint,
+		}
+	}
+	return &ast.FieldList{List: xs}
+}
+
 func (r *importReader) signature() *ast.FuncType {
 	params := r.paramList()
 	results := r.paramList()
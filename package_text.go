@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"strconv"
 	"text/scanner"
@@ -70,7 +71,7 @@ func (p *gc_parser) init(data []byte, pfc *package_file_cache) {
 func (p *gc_parser) next() {
 	p.tok = p.scanner.Scan()
 	switch p.tok {
-	case scanner.Ident, scanner.Int, scanner.String:
+	case scanner.Ident, scanner.Int, scanner.String, scanner.Char:
 		p.lit = p.scanner.TokenText()
 	default:
 		p.lit = ""
@@ -301,21 +302,35 @@ func (p *gc_parser) parse_method_or_embed_spec() *ast.Field {
 }
 
 // int_lit = [ "-" | "+" ] { "0" ... "9" } .
-func (p *gc_parser) parse_int() {
+func (p *gc_parser) parse_int() string {
+	neg := ""
 	switch p.tok {
-	case '-', '+':
+	case '-':
+		neg = "-"
+		p.next()
+	case '+':
 		p.next()
 	}
-	p.expect(scanner.Int)
+	return neg + p.expect(scanner.Int)
 }
 
 // number = int_lit [ "p" int_lit ] .
-func (p *gc_parser) parse_number() {
-	p.parse_int()
+func (p *gc_parser) parse_number() constant.Value {
+	mant := constant.MakeFromLiteral(p.parse_int(), token.INT, 0)
 	if p.lit == "p" {
+		// exponent (base 2)
 		p.next()
-		p.parse_int()
+		exp, err := strconv.ParseInt(p.parse_int(), 10, 0)
+		if err != nil {
+			p.error(err.Error())
+		}
+		if exp < 0 {
+			d := constant.Shift(constant.MakeInt64(1), token.SHL, uint(-exp))
+			return constant.BinaryOp(mant, token.QUO, d)
+		}
+		return constant.ToFloat(constant.Shift(mant, token.SHL, uint(exp)))
 	}
+	return mant
 }
 
 //-------------------------------------------------------------------------------
@@ -484,7 +499,6 @@ func (p *gc_parser) parse_import_decl() {
 // rune_lit    = "(" int_lit "+" int_lit ")" .
 // string_lit  = `"` { unicode_char } `"` .
 func (p *gc_parser) parse_const_decl() (string, *ast.GenDecl) {
-	// TODO: do we really need actual const value? gocode doesn't use this
 	p.expect_keyword("const")
 	name := p.parse_exported_name()
 
@@ -495,28 +509,35 @@ func (p *gc_parser) parse_const_decl() (string, *ast.GenDecl) {
 
 	p.expect('=')
 
-	// skip the value
+	var val constant.Value
 	switch p.tok {
 	case scanner.Ident:
 		// must be bool, true or false
+		val = constant.MakeBool(p.lit == "true")
 		p.next()
 	case '-', '+', scanner.Int:
 		// number
-		p.parse_number()
+		val = p.parse_number()
 	case '(':
 		// complex_lit or rune_lit
 		p.next() // skip '('
 		if p.tok == scanner.Char {
 			p.next()
-		} else {
-			p.parse_number()
+			p.expect('+')
+			val = p.parse_number()
+			p.expect(')')
+			break
 		}
+		re := p.parse_number()
 		p.expect('+')
-		p.parse_number()
+		im := p.parse_number()
 		p.expect(')')
+		val = constant.BinaryOp(re, token.ADD, constant.MakeImag(im))
 	case scanner.Char:
+		val = constant.MakeFromLiteral(p.lit, token.CHAR, 0)
 		p.next()
 	case scanner.String:
+		val = constant.MakeFromLiteral(p.lit, token.STRING, 0)
 		p.next()
 	default:
 		p.error("expected literal")
@@ -528,7 +549,7 @@ func (p *gc_parser) parse_const_decl() (string, *ast.GenDecl) {
 			&ast.ValueSpec{
 				Names:  []*ast.Ident{name.Sel},
 				Type:   typ,
-				Values: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0"}},
+				Values: []ast.Expr{constant_to_expr(val)},
 			},
 		},
 	}
@@ -598,27 +619,29 @@ func strip_method_receiver(recv *ast.FieldList) string {
 
 	// find selector expression
 	typ := recv.List[0].Type
-	switch t := typ.(type) {
-	case *ast.StarExpr:
-		sel, _ = t.X.(*ast.SelectorExpr)
-	case *ast.SelectorExpr:
-		sel = t
+	if t, ok := typ.(*ast.StarExpr); ok {
+		typ = t.X
 	}
+	sel, _ = strip_type_args(typ).(*ast.SelectorExpr)
 
 	// extract package path
 	if sel != nil {
 		pkg := sel.X.(*ast.Ident).Name
 
-		// write back stripped type
-		switch typ.(type) {
-		case *ast.StarExpr:
-			*recv = ast.FieldList{
-				List: []*ast.Field{{Names: recv.List[0].Names, Type: &ast.StarExpr{X: sel.Sel}}},
-			}
-		case *ast.SelectorExpr:
-			*recv = ast.FieldList{
-				List: []*ast.Field{{Names: recv.List[0].Names, Type: sel.Sel}},
-			}
+		// write back stripped type, receivers of generic types keep their
+		// type arguments
+		var stripped ast.Expr = sel.Sel
+		switch t := typ.(type) {
+		case *ast.IndexExpr:
+			stripped = &ast.IndexExpr{X: sel.Sel, Index: t.Index}
+		case *ast.IndexListExpr:
+			stripped = &ast.IndexListExpr{X: sel.Sel, Indices: t.Indices}
+		}
+		if _, ok := recv.List[0].Type.(*ast.StarExpr); ok {
+			stripped = &ast.StarExpr{X: stripped}
+		}
+		*recv = ast.FieldList{
+			List: []*ast.Field{{Names: recv.List[0].Names, Type: stripped}},
 		}
 		return pkg
 	} else {
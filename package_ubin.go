@@ -0,0 +1,815 @@
+package main
+
+//-------------------------------------------------------------------------
+// gc_ubin_parser
+//
+// Reader for the unified IR export format ('u'), used by Go 1.20 and later.
+//
+// The following part of the code may contain portions of the code from the Go
+// standard library, which tells me to retain their copyright notice:
+//
+// Copyright (c) 2021 The Go Authors. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//    * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//    * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//    * Neither the name of Google Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//-------------------------------------------------------------------------
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math/big"
+	"strings"
+)
+
+// export data versions, see internal/pkgbits
+const (
+	ubinVersion0       = iota // initial
+	ubinVersion1              // flags word in the header
+	ubinVersion2              // alias type params, legacy fields removed
+	ubinVersion3              // compact composite literals, not our business
+	ubinVersion4              // generic methods
+	ubinVersionCurrent = ubinVersion4
+)
+
+// sections
+const (
+	ubinSectionString = iota
+	ubinSectionMeta
+	ubinSectionPosBase
+	ubinSectionPkg
+	ubinSectionName
+	ubinSectionType
+	ubinSectionObj
+	ubinSectionObjExt
+	ubinSectionObjDict
+	ubinSectionBody
+	ubinNumSections
+)
+
+// type codes
+const (
+	ubinTypeBasic = iota
+	ubinTypeNamed
+	ubinTypePointer
+	ubinTypeSlice
+	ubinTypeArray
+	ubinTypeChan
+	ubinTypeMap
+	ubinTypeSignature
+	ubinTypeStruct
+	ubinTypeInterface
+	ubinTypeUnion
+	ubinTypeTypeParam
+)
+
+// object codes
+const (
+	ubinObjAlias = iota
+	ubinObjConst
+	ubinObjType
+	ubinObjFunc
+	ubinObjVar
+	ubinObjStub
+)
+
+// value codes
+const (
+	ubinValBool = iota
+	ubinValString
+	ubinValInt64
+	ubinValBigInt
+	ubinValBigRat
+	ubinValBigFloat
+)
+
+// indexed by types.BasicKind
+var ubinBasicTypes = []ast.Expr{
+	ast.NewIdent(">_<"), // invalid type
+	ast.NewIdent("bool"),
+	ast.NewIdent("int"),
+	ast.NewIdent("int8"),
+	ast.NewIdent("int16"),
+	ast.NewIdent("int32"),
+	ast.NewIdent("int64"),
+	ast.NewIdent("uint"),
+	ast.NewIdent("uint8"),
+	ast.NewIdent("uint16"),
+	ast.NewIdent("uint32"),
+	ast.NewIdent("uint64"),
+	ast.NewIdent("uintptr"),
+	ast.NewIdent("float32"),
+	ast.NewIdent("float64"),
+	ast.NewIdent("complex64"),
+	ast.NewIdent("complex128"),
+	ast.NewIdent("string"),
+	&ast.SelectorExpr{X: ast.NewIdent("unsafe"), Sel: ast.NewIdent("Pointer")},
+	ast.NewIdent("&untypedBool&"),
+	ast.NewIdent("&untypedInt&"),
+	ast.NewIdent("&untypedRune&"),
+	ast.NewIdent("&untypedFloat&"),
+	ast.NewIdent("&untypedComplex&"),
+	ast.NewIdent("&untypedString&"),
+	ast.NewIdent("&untypedNil&"),
+}
+
+type gc_ubin_parser struct {
+	data     string
+	version  int
+	sync     bool
+	callback func(pkg string, decl ast.Decl)
+	pfc      *package_file_cache
+
+	elemData     string
+	elemEnds     []uint32
+	elemEndsEnds [ubinNumSections]uint32
+
+	local int        // index of the package being imported
+	pkgs  []string   // full package names ("!path!name"), "" for builtin
+	typs  []ast.Expr // non-derived types
+	objs  []bool     // objects which were already processed
+	files []string   // file names of the position bases
+}
+
+func (p *gc_ubin_parser) init(data []byte, pfc *package_file_cache) {
+	p.data = string(data)
+	p.pfc = pfc
+}
+
+func (p *gc_ubin_parser) parse_export(callback func(string, ast.Decl)) {
+	p.callback = callback
+
+	data := p.data
+	u32 := func() uint32 {
+		if len(data) < 4 {
+			panic("unexpected end of export data header")
+		}
+		v := binary.LittleEndian.Uint32([]byte(data[:4]))
+		data = data[4:]
+		return v
+	}
+
+	p.version = int(u32())
+	if p.version > ubinVersionCurrent {
+		panic(fmt.Errorf("unknown export format version %d", p.version))
+	}
+	if p.version >= ubinVersion1 {
+		p.sync = u32()&1 != 0
+	}
+	for i := range p.elemEndsEnds {
+		p.elemEndsEnds[i] = u32()
+	}
+	p.elemEnds = make([]uint32, p.elemEndsEnds[ubinNumSections-1])
+	for i := range p.elemEnds {
+		p.elemEnds[i] = u32()
+	}
+	// export data is followed by an 8 bytes fingerprint and the end of
+	// section marker, we don't need either of them
+	p.elemData = data
+
+	p.pkgs = make([]string, p.num_elems(ubinSectionPkg))
+	p.typs = make([]ast.Expr, p.num_elems(ubinSectionType))
+	p.objs = make([]bool, p.num_elems(ubinSectionName))
+	p.files = make([]string, p.num_elems(ubinSectionPosBase))
+
+	// public root: local package and the list of its objects
+	r := p.new_reader(ubinSectionMeta, 0)
+	r.sync()
+	p.local = r.reloc()
+	p.pkg_at(p.local)
+	if p.version < ubinVersion2 {
+		r.bool() // has init
+	}
+	for n := r.len(); n > 0; n-- {
+		r.sync()
+		if p.version < ubinVersion2 {
+			r.bool() // derived func instance
+		}
+		p.obj(r.reloc())
+		r.len() // type arguments, always none
+	}
+}
+
+func (p *gc_ubin_parser) num_elems(k int) int {
+	n := int(p.elemEndsEnds[k])
+	if k > 0 {
+		n -= int(p.elemEndsEnds[k-1])
+	}
+	return n
+}
+
+func (p *gc_ubin_parser) elem(k, idx int) string {
+	abs := idx
+	if k > 0 {
+		abs += int(p.elemEndsEnds[k-1])
+	}
+	if abs >= int(p.elemEndsEnds[k]) {
+		panic(fmt.Sprintf("element %d:%d is out of bounds", k, idx))
+	}
+	var start uint32
+	if abs > 0 {
+		start = p.elemEnds[abs-1]
+	}
+	return p.elemData[start:p.elemEnds[abs]]
+}
+
+func (p *gc_ubin_parser) new_reader(k, idx int) *ubinReader {
+	r := &ubinReader{p: p}
+	r.data.Reset(p.elem(k, idx))
+	r.sync()
+	r.relocs = make([]int, r.len())
+	for i := range r.relocs {
+		r.sync()
+		r.len() // section, implied by the context
+		r.relocs[i] = r.len()
+	}
+	r.sync()
+	return r
+}
+
+//-------------------------------------------------------------------------
+// packages and objects
+//-------------------------------------------------------------------------
+
+func (p *gc_ubin_parser) file_at(idx int) string {
+	if file := p.files[idx]; file != "" {
+		return file
+	}
+	r := p.new_reader(ubinSectionPosBase, idx)
+	p.files[idx] = r.string()
+	return p.files[idx]
+}
+
+func (p *gc_ubin_parser) pkg_at(idx int) string {
+	if pkg := p.pkgs[idx]; pkg != "" {
+		return pkg
+	}
+
+	r := p.new_reader(ubinSectionPkg, idx)
+	var pkg string
+	switch path := r.string(); {
+	case path == "builtin":
+		return ""
+	case path == "unsafe":
+		pkg = "unsafe"
+	case path == "" || idx == p.local:
+		// imported package
+		name := r.string()
+		pkg = "!" + p.pfc.name + "!" + name
+		p.pfc.defalias = name
+	default:
+		// third party import
+		pkg = "!" + path + "!" + r.string()
+		p.pfc.add_package_to_scope(pkg, path)
+	}
+	p.pkgs[idx] = pkg
+	return pkg
+}
+
+// Reads (if it's not read yet) the object at index 'idx' and returns its
+// package and name.
+func (p *gc_ubin_parser) obj(idx int) (string, string) {
+	rname := p.new_reader(ubinSectionName, idx)
+	pkg, name := rname.ident()
+	tag := rname.code()
+
+	if tag == ubinObjStub || p.objs[idx] {
+		return pkg, name
+	}
+	// local types and the like, never mind
+	if strings.ContainsAny(name, ".·") {
+		return pkg, name
+	}
+	p.objs[idx] = true
+
+	r := p.new_reader(ubinSectionObj, idx)
+	r.dict = p.obj_dict(idx)
+	pos := r.pos()
+
+	switch tag {
+	case ubinObjAlias:
+		if p.version >= ubinVersion2 {
+			r.type_param_names(false) // generic aliases are treated as plain ones
+		}
+		typ := r.typ()
+		spec := typeAliasSpec(name, typ)
+		spec.Name.NamePos = pos
+		p.callback(pkg, &ast.GenDecl{
+			Tok:   token.TYPE,
+			Specs: []ast.Spec{spec},
+		})
+	case ubinObjConst:
+		typ := r.typ()
+		val := r.value()
+		p.callback(pkg, &ast.GenDecl{
+			Tok: token.CONST,
+			Specs: []ast.Spec{
+				&ast.ValueSpec{
+					Names:  []*ast.Ident{{NamePos: pos, Name: name}},
+					Type:   typ,
+					Values: []ast.Expr{constant_to_expr(val)},
+				},
+			},
+		})
+	case ubinObjFunc:
+		if p.version >= ubinVersion4 {
+			r.bool() // generic method, these are read with their types
+		}
+		tparams := r.type_param_names(false)
+		sig := r.signature()
+		sig.TypeParams = tparams
+		p.callback(pkg, &ast.FuncDecl{
+			Name: &ast.Ident{NamePos: pos, Name: name},
+			Type: sig,
+		})
+	case ubinObjType:
+		tparams := r.type_param_names(false)
+		typ := r.typ()
+		p.callback(pkg, &ast.GenDecl{
+			Tok: token.TYPE,
+			Specs: []ast.Spec{
+				&ast.TypeSpec{
+					Name:       &ast.Ident{NamePos: pos, Name: name},
+					TypeParams: tparams,
+					Type:       typ,
+				},
+			},
+		})
+
+		for n := r.len(); n > 0; n-- {
+			r.sync()
+			mpos := r.pos()
+			_, mname := r.ident()
+			r.type_param_names(false) // receiver type params
+			recv := &ast.FieldList{List: []*ast.Field{r.param()}}
+			msig := r.signature()
+			r.pos()
+			p.method(pkg, mname, mpos, recv, msig)
+		}
+		if p.version >= ubinVersion4 {
+			for n := r.len(); n > 0; n-- {
+				midx := r.reloc()
+				mr := p.new_reader(ubinSectionObj, midx)
+				mr.dict = p.obj_dict(midx)
+				mpos := mr.pos()
+				mr.bool() // generic method
+				_, mname := mr.ident()
+				mr.type_param_names(true)
+				recv := &ast.FieldList{List: []*ast.Field{mr.param()}}
+				mtparams := mr.type_param_names(false)
+				msig := mr.signature()
+				msig.TypeParams = mtparams
+				p.method(pkg, mname, mpos, recv, msig)
+			}
+		}
+	case ubinObjVar:
+		typ := r.typ()
+		p.callback(pkg, &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{
+				&ast.ValueSpec{
+					Names: []*ast.Ident{{NamePos: pos, Name: name}},
+					Type:  typ,
+				},
+			},
+		})
+	default:
+		panic(fmt.Sprintf("unexpected object tag: %d", tag))
+	}
+	return pkg, name
+}
+
+func (p *gc_ubin_parser) method(pkg, name string, pos token.Pos, recv *ast.FieldList, sig *ast.FuncType) {
+	strip_method_receiver(recv)
+	p.callback(pkg, &ast.FuncDecl{
+		Recv: recv,
+		Name: &ast.Ident{NamePos: pos, Name: name},
+		Type: sig,
+	})
+}
+
+//-------------------------------------------------------------------------
+// type dictionaries
+//
+// Generic objects carry a dictionary, type parameters and types which
+// depend on them ("derived" types) are referred to through it.
+//-------------------------------------------------------------------------
+
+type ubinTypeInfo struct {
+	idx     int
+	derived bool
+}
+
+type ubinDict struct {
+	rtbounds []ubinTypeInfo
+	tbounds  []ubinTypeInfo
+	rtparams []ast.Expr
+	tparams  []ast.Expr
+
+	derived      []int
+	derivedTypes []ast.Expr
+}
+
+func (p *gc_ubin_parser) obj_dict(idx int) *ubinDict {
+	r := p.new_reader(ubinSectionObjDict, idx)
+	if implicits := r.len(); implicits != 0 {
+		panic(fmt.Sprintf("unexpected object with %d implicit type parameter(s)", implicits))
+	}
+
+	var d ubinDict
+	nreceivers := 0
+	if p.version >= ubinVersion4 {
+		nreceivers = r.len()
+	}
+	nexplicits := r.len()
+	d.rtbounds = make([]ubinTypeInfo, nreceivers)
+	for i := range d.rtbounds {
+		d.rtbounds[i] = r.typ_info()
+	}
+	d.tbounds = make([]ubinTypeInfo, nexplicits)
+	for i := range d.tbounds {
+		d.tbounds[i] = r.typ_info()
+	}
+
+	d.derived = make([]int, r.len())
+	d.derivedTypes = make([]ast.Expr, len(d.derived))
+	for i := range d.derived {
+		d.derived[i] = r.reloc()
+		if p.version < ubinVersion2 {
+			r.bool() // needed
+		}
+	}
+	return &d
+}
+
+func (p *gc_ubin_parser) typ_at(info ubinTypeInfo, dict *ubinDict) ast.Expr {
+	idx := info.idx
+	var where *ast.Expr
+	if info.derived {
+		where = &dict.derivedTypes[idx]
+		idx = dict.derived[idx]
+	} else {
+		where = &p.typs[idx]
+	}
+	if *where != nil {
+		return *where
+	}
+
+	r := p.new_reader(ubinSectionType, idx)
+	r.dict = dict
+	typ := r.do_typ()
+	if *where == nil {
+		*where = typ
+	}
+	return *where
+}
+
+//-------------------------------------------------------------------------
+// ubinReader
+//-------------------------------------------------------------------------
+
+type ubinReader struct {
+	p      *gc_ubin_parser
+	data   strings.Reader
+	relocs []int
+	dict   *ubinDict
+}
+
+// sync markers are there for debugging purposes only, skip them
+func (r *ubinReader) sync() {
+	if !r.p.sync {
+		return
+	}
+	r.raw_uvarint()
+	for n := r.raw_uvarint(); n > 0; n-- {
+		r.raw_uvarint()
+	}
+}
+
+func (r *ubinReader) raw_uvarint() uint64 {
+	x, err := binary.ReadUvarint(&r.data)
+	if err != nil {
+		panic(fmt.Sprintf("read uvarint error: %v", err))
+	}
+	return x
+}
+
+func (r *ubinReader) bool() bool {
+	r.sync()
+	x, err := r.data.ReadByte()
+	if err != nil {
+		panic(fmt.Sprintf("read byte error: %v", err))
+	}
+	return x != 0
+}
+
+func (r *ubinReader) int64() int64 {
+	r.sync()
+	ux := r.raw_uvarint()
+	x := int64(ux >> 1)
+	if ux&1 != 0 {
+		x = ^x
+	}
+	return x
+}
+
+func (r *ubinReader) uint64() uint64 {
+	r.sync()
+	return r.raw_uvarint()
+}
+
+func (r *ubinReader) len() int   { return int(r.uint64()) }
+func (r *ubinReader) code() int  { r.sync(); return r.len() }
+func (r *ubinReader) reloc() int { r.sync(); return r.relocs[r.len()] }
+
+func (r *ubinReader) string() string {
+	r.sync()
+	return r.p.elem(ubinSectionString, r.reloc())
+}
+
+func (r *ubinReader) pkg() string {
+	r.sync()
+	return r.p.pkg_at(r.reloc())
+}
+
+func (r *ubinReader) ident() (string, string) {
+	r.sync()
+	return r.pkg(), r.string()
+}
+
+func (r *ubinReader) pos() token.Pos {
+	r.sync()
+	if !r.bool() {
+		return token.NoPos
+	}
+	file := r.p.file_at(r.reloc())
+	line := r.uint64()
+	column := r.uint64()
+	return r.p.pfc.add_pos(file, int(line), int(column))
+}
+
+func (r *ubinReader) value() constant.Value {
+	r.sync()
+	complex := r.bool()
+	v := r.scalar()
+	if complex {
+		v = constant.BinaryOp(v, token.ADD, constant.MakeImag(r.scalar()))
+	}
+	return v
+}
+
+func (r *ubinReader) scalar() constant.Value {
+	switch tag := r.code(); tag {
+	case ubinValBool:
+		return constant.MakeBool(r.bool())
+	case ubinValString:
+		return constant.MakeString(r.string())
+	case ubinValInt64:
+		return constant.MakeInt64(r.int64())
+	case ubinValBigInt:
+		return constant.Make(r.big_int())
+	case ubinValBigRat:
+		num := r.big_int()
+		denom := r.big_int()
+		return constant.Make(new(big.Rat).SetFrac(num, denom))
+	case ubinValBigFloat:
+		v := new(big.Float).SetPrec(512)
+		if err := v.UnmarshalText([]byte(r.string())); err != nil {
+			panic(err)
+		}
+		return constant.Make(v)
+	default:
+		panic(fmt.Sprintf("unexpected scalar tag: %d", tag))
+	}
+}
+
+func (r *ubinReader) big_int() *big.Int {
+	v := new(big.Int).SetBytes([]byte(r.string()))
+	if r.bool() {
+		v.Neg(v)
+	}
+	return v
+}
+
+func (r *ubinReader) typ_info() ubinTypeInfo {
+	r.sync()
+	if r.bool() {
+		return ubinTypeInfo{idx: r.len(), derived: true}
+	}
+	return ubinTypeInfo{idx: r.reloc()}
+}
+
+func (r *ubinReader) typ() ast.Expr {
+	return r.p.typ_at(r.typ_info(), r.dict)
+}
+
+func (r *ubinReader) do_typ() ast.Expr {
+	switch tag := r.code(); tag {
+	case ubinTypeBasic:
+		kind := r.len()
+		if kind >= len(ubinBasicTypes) {
+			panic(fmt.Sprintf("unexpected basic type: %d", kind))
+		}
+		return ubinBasicTypes[kind]
+	case ubinTypeNamed:
+		r.sync()
+		if r.p.version < ubinVersion2 {
+			r.bool() // derived func instance
+		}
+		pkg, name := r.p.obj(r.reloc())
+		var typ ast.Expr
+		switch pkg {
+		case "":
+			typ = ast.NewIdent(name)
+		default:
+			typ = &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent(name)}
+		}
+		targs := make([]ast.Expr, r.len())
+		for i := range targs {
+			targs[i] = r.typ()
+		}
+		switch len(targs) {
+		case 0:
+			return typ
+		case 1:
+			return &ast.IndexExpr{X: typ, Index: targs[0]}
+		}
+		return &ast.IndexListExpr{X: typ, Indices: targs}
+	case ubinTypeTypeParam:
+		n := r.len()
+		if n < len(r.dict.rtparams) {
+			return r.dict.rtparams[n]
+		}
+		return r.dict.tparams[n-len(r.dict.rtparams)]
+	case ubinTypeArray:
+		n := r.uint64()
+		return &ast.ArrayType{
+			Len: &ast.BasicLit{Kind: token.INT, Value: fmt.Sprint(n)},
+			Elt: r.typ(),
+		}
+	case ubinTypeChan:
+		dir := ast.SEND | ast.RECV
+		switch d := r.len(); d {
+		case 1:
+			dir = ast.SEND
+		case 2:
+			dir = ast.RECV
+		}
+		return &ast.ChanType{Dir: dir, Value: r.typ()}
+	case ubinTypeMap:
+		key := r.typ()
+		return &ast.MapType{Key: key, Value: r.typ()}
+	case ubinTypePointer:
+		return &ast.StarExpr{X: r.typ()}
+	case ubinTypeSignature:
+		return r.signature()
+	case ubinTypeSlice:
+		return &ast.ArrayType{Elt: r.typ()}
+	case ubinTypeStruct:
+		fields := make([]*ast.Field, r.len())
+		for i := range fields {
+			fpos := r.pos()
+			_, fname := r.ident()
+			ftyp := r.typ()
+			r.string() // tag
+			var names []*ast.Ident
+			if !r.bool() { // embedded
+				names = []*ast.Ident{{NamePos: fpos, Name: fname}}
+			}
+			fields[i] = &ast.Field{Names: names, Type: ftyp}
+		}
+		return &ast.StructType{Fields: &ast.FieldList{List: fields}}
+	case ubinTypeInterface:
+		methods := make([]*ast.Field, r.len())
+		embeddeds := make([]ast.Expr, r.len())
+		implicit := len(methods) == 0 && len(embeddeds) == 1 && r.bool()
+		for i := range methods {
+			mpos := r.pos()
+			_, mname := r.ident()
+			methods[i] = &ast.Field{
+				Names: []*ast.Ident{{NamePos: mpos, Name: mname}},
+				Type:  r.signature(),
+			}
+		}
+		for i := range embeddeds {
+			embeddeds[i] = r.typ()
+		}
+		if implicit {
+			// constraint literal, e.g. [T ~int | ~string]
+			return embeddeds[0]
+		}
+		for _, e := range embeddeds {
+			switch e.(type) {
+			case *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+				methods = append(methods, &ast.Field{Type: e})
+			}
+		}
+		return &ast.InterfaceType{Methods: &ast.FieldList{List: methods}}
+	case ubinTypeUnion:
+		var union ast.Expr
+		for n := r.len(); n > 0; n-- {
+			tilde := r.bool()
+			term := r.typ()
+			if tilde {
+				term = &ast.UnaryExpr{Op: token.TILDE, X: term}
+			}
+			if union == nil {
+				union = term
+			} else {
+				union = &ast.BinaryExpr{X: union, Op: token.OR, Y: term}
+			}
+		}
+		return union
+	default:
+		panic(fmt.Sprintf("unexpected type tag: %d", tag))
+	}
+}
+
+func (r *ubinReader) signature() *ast.FuncType {
+	r.sync()
+	params := r.params()
+	results := r.params()
+	if r.bool() { // variadic
+		last := params.List[len(params.List)-1]
+		last.Type = &ast.Ellipsis{Elt: last.Type.(*ast.ArrayType).Elt}
+	}
+	return &ast.FuncType{Params: params, Results: results}
+}
+
+func (r *ubinReader) params() *ast.FieldList {
+	r.sync()
+	xs := make([]*ast.Field, r.len())
+	for i := range xs {
+		xs[i] = r.param()
+	}
+	return &ast.FieldList{List: xs}
+}
+
+func (r *ubinReader) param() *ast.Field {
+	r.sync()
+	r.pos()
+	_, name := r.ident()
+	if name == "" { // gocode specific hack for unnamed parameters
+		name = "?"
+	}
+	return &ast.Field{
+		Names: []*ast.Ident{ast.NewIdent(name)},
+		Type:  r.typ(),
+	}
+}
+
+// Reads type parameter names of the current object, their constraints are
+// read from the dictionary afterwards, because they may refer to the type
+// parameters themselves.
+func (r *ubinReader) type_param_names(receiver bool) *ast.FieldList {
+	r.sync()
+	in, out := r.dict.tbounds, &r.dict.tparams
+	if receiver {
+		in, out = r.dict.rtbounds, &r.dict.rtparams
+	}
+	if len(in) == 0 {
+		return nil
+	}
+
+	names := make([]ast.Expr, len(in))
+	for i := range names {
+		r.pos()
+		_, name := r.ident()
+		names[i] = ast.NewIdent(name)
+	}
+	*out = names
+
+	fields := make([]*ast.Field, len(in))
+	for i, info := range in {
+		fields[i] = &ast.Field{
+			Names: []*ast.Ident{names[i].(*ast.Ident)},
+			Type:  r.p.typ_at(info, r.dict),
+		}
+	}
+	return &ast.FieldList{List: fields}
+}
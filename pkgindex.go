@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//-------------------------------------------------------------------------
+// package_index
+//
+// Names and import paths of the packages which can be imported, used to
+// resolve identifiers of packages which are not imported yet. The index is
+// built in background, see the "unimported-packages" config option.
+//-------------------------------------------------------------------------
+
+type package_index_entry struct {
+	name      string
+	path      string // import path
+	dir       string
+	symbols   []string // exported top-level declarations
+	importers int      // number of indexed packages importing it
+}
+
+type package_index struct {
+	sync.Mutex
+	roots    []import_root
+	packages map[string][]package_index_entry // package name -> packages
+}
+
+func new_package_index() *package_index {
+	return &package_index{packages: make(map[string][]package_index_entry)}
+}
+
+// Starts rebuilding the index in background if the roots have changed,
+// the old index is used until the new one is ready.
+func (x *package_index) update(roots []import_root) {
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].dir < roots[j].dir
+	})
+
+	x.Lock()
+	defer x.Unlock()
+	if x.roots != nil && reflect.DeepEqual(x.roots, roots) {
+		return
+	}
+	x.roots = roots
+
+	go func() {
+		packages := make(map[string][]package_index_entry)
+		importers := make(map[string]int)
+		for _, root := range roots {
+			index_packages(root, root.dir, packages, importers)
+		}
+		for _, entries := range packages {
+			for i := range entries {
+				entries[i].importers = importers[entries[i].path]
+			}
+		}
+		if *g_debug {
+			log.Printf("Package index built: %d package names\n", len(packages))
+		}
+
+		x.Lock()
+		defer x.Unlock()
+		if reflect.DeepEqual(x.roots, roots) {
+			x.packages = packages
+		}
+	}()
+}
+
+// Returns the packages named 'name' which can be imported by the package
+// with the import path 'from'.
+func (x *package_index) lookup(name, from string) []package_index_entry {
+	x.Lock()
+	defer x.Unlock()
+	var r []package_index_entry
+	for _, e := range x.packages[name] {
+		if e.path != from && importable(e.path, from) {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+// Returns the packages importable by 'from' which have an exported symbol
+// matching the 'partial' input.
+func (x *package_index) lookup_symbol(partial, from string, ignorecase bool) []package_index_entry {
+	x.Lock()
+	defer x.Unlock()
+	var r []package_index_entry
+	for _, entries := range x.packages {
+		for _, e := range entries {
+			if e.path == from || !importable(e.path, from) {
+				continue
+			}
+			for _, s := range e.symbols {
+				if _, ok := match_candidate(s, partial, ignorecase); ok {
+					r = append(r, e)
+					break
+				}
+			}
+		}
+	}
+	return r
+}
+
+// Indexes packages in 'dir' and its subdirectories, 'importers' counts the
+// packages importing each import path.
+func index_packages(root import_root, dir string, packages map[string][]package_index_entry, importers map[string]int) {
+	fi, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var files []string
+	for _, f := range fi {
+		fname := f.Name()
+		if f.IsDir() {
+			switch {
+			case fname == "testdata" || fname == "vendor":
+				continue
+			case strings.HasPrefix(fname, ".") || strings.HasPrefix(fname, "_"):
+				continue
+			case root.path == "" && dir == root.dir && fname == "cmd":
+				continue
+			}
+			subdir := filepath.Join(dir, fname)
+			if file_exists(filepath.Join(subdir, "go.mod")) {
+				// nested module
+				continue
+			}
+			index_packages(root, subdir, packages, importers)
+			continue
+		}
+		if strings.HasSuffix(fname, ".go") && !strings.HasSuffix(fname, "_test.go") {
+			files = append(files, filepath.Join(dir, fname))
+		}
+	}
+	ipath := import_path_in_root(root, dir)
+	if len(files) == 0 || ipath == "" {
+		return
+	}
+
+	// symbols come from the installed archive if there is one, the source
+	// code is parsed otherwise
+	symbols := archive_symbols(root, ipath)
+	parse_symbols := symbols == nil
+	if parse_symbols {
+		symbols = make(map[string]bool)
+	}
+	name := ""
+	imports := make(map[string]bool)
+	for _, filename := range files {
+		var s map[string]bool
+		if parse_symbols {
+			s = symbols
+		}
+		// "package main" files next to library ones are usually
+		// generators excluded by build constraints
+		n := index_file(filename, s, imports)
+		if name == "" && n != "main" && n != "documentation" {
+			name = n
+		}
+	}
+	if name == "" {
+		return
+	}
+	e := package_index_entry{
+		name:    name,
+		path:    ipath,
+		dir:     dir,
+		symbols: make([]string, 0, len(symbols)),
+	}
+	for s := range symbols {
+		e.symbols = append(e.symbols, s)
+	}
+	packages[name] = append(packages[name], e)
+	for imp := range imports {
+		importers[imp]++
+	}
+}
+
+// Returns exported top-level declarations of the package from its installed
+// archive, nil if there is no archive.
+func archive_symbols(root import_root, ipath string) map[string]bool {
+	if root.pkgdir == "" {
+		return nil
+	}
+	archive := filepath.Join(root.pkgdir, filepath.FromSlash(ipath)+".a")
+	if !file_exists(archive) {
+		return nil
+	}
+	p := new_package_file_cache(archive, ipath)
+	p.update_cache()
+	if p.main == nil {
+		return nil
+	}
+	symbols := make(map[string]bool)
+	for name := range p.main.children {
+		if ast.IsExported(name) {
+			symbols[name] = true
+		}
+	}
+	return symbols
+}
+
+// Adds exported top-level declarations of the file to 'symbols' (unless it's
+// nil, only imports are parsed then) and its imports to 'imports', returns
+// the package name. Declarations of other OS or architectures are indexed as
+// well, they are filtered out when the package is loaded.
+func index_file(filename string, symbols, imports map[string]bool) string {
+	mode := parser.SkipObjectResolution
+	if symbols == nil {
+		mode |= parser.ImportsOnly
+	}
+	file, _ := parser.ParseFile(token.NewFileSet(), filename, nil, mode)
+	if file == nil || file.Name == nil {
+		return ""
+	}
+	if file.Name.Name == "main" {
+		return "main"
+	}
+	for _, imp := range file.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err == nil {
+			imports[path] = true
+		}
+	}
+	if symbols == nil {
+		return file.Name.Name
+	}
+	add := func(name *ast.Ident) {
+		if name.IsExported() {
+			symbols[name.Name] = true
+		}
+	}
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				add(d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						add(name)
+					}
+				}
+			}
+		}
+	}
+	return file.Name.Name
+}
+
+// Internal packages can be imported only by packages rooted at the parent of
+// the "internal" directory.
+func importable(imp, from string) bool {
+	i := strings.LastIndex(imp, "/internal/")
+	switch {
+	case i != -1:
+	case strings.HasSuffix(imp, "/internal"):
+		i = len(imp) - len("/internal")
+	case strings.HasPrefix(imp, "internal/") || imp == "internal":
+		// the standard library ones
+		return false
+	default:
+		return true
+	}
+	parent := imp[:i]
+	return from == parent || strings.HasPrefix(from, parent+"/")
+}
+
+// Ranks packages with the same name: the ones imported by other files of the
+// current package go first, then the ones imported by more indexed packages,
+// then standard library ones and shorter import paths.
+func rank_packages(entries []package_index_entry, imported map[string]bool) {
+	rank := func(e package_index_entry) int {
+		if !strings.Contains(strings.SplitN(e.path, "/", 2)[0], ".") {
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		x, y := entries[i], entries[j]
+		if ix, iy := imported[x.path], imported[y.path]; ix != iy {
+			return ix
+		}
+		if x.importers != y.importers {
+			return x.importers > y.importers
+		}
+		if rx, ry := rank(x), rank(y); rx != ry {
+			return rx < ry
+		}
+		if nx, ny := strings.Count(x.path, "/"), strings.Count(y.path, "/"); nx != ny {
+			return nx < ny
+		}
+		return x.path < y.path
+	})
+}
+
+// Returns the directories to index: GOROOT plus either GOPATH or the current
+// module with its dependencies.
+func (ctxt *package_lookup_context) index_roots() []import_root {
+	if roots := ctxt.import_roots(); roots != nil {
+		return roots
+	}
+	var roots []import_root
+	pkgdir := filepath.Join("pkg", ctxt.GOOS+"_"+ctxt.GOARCH)
+	if ctxt.GOROOT != "" {
+		roots = append(roots, import_root{
+			dir:    filepath.Join(ctxt.GOROOT, "src"),
+			pkgdir: filepath.Join(ctxt.GOROOT, pkgdir),
+		})
+	}
+	for _, p := range ctxt.gopath() {
+		roots = append(roots, import_root{
+			dir:    filepath.Join(p, "src"),
+			pkgdir: filepath.Join(p, pkgdir),
+		})
+	}
+	return roots
+}
+
+//-------------------------------------------------------------------------
+// text_edit
+//-------------------------------------------------------------------------
+
+// Additional change of the file a candidate requires, e.g. an import.
+type text_edit struct {
+	Offset int    `json:"offset"` // byte offset in the file
+	Length int    `json:"length"` // number of bytes to replace
+	Text   string `json:"text"`
+}
+
+// Returns the edit which adds an import of the package 'name' with the import
+// path 'imp' to the file. The name is specified only if it doesn't match the
+// last element of the path (a major version suffix aside).
+func import_edit(file []byte, name, imp string) text_edit {
+	base := path.Base(imp)
+	if len(base) > 1 && base[0] == 'v' && strings.Trim(base[1:], "0123456789") == "" {
+		// "math/rand/v2"
+		base = path.Base(path.Dir(imp))
+	}
+	spec := fmt.Sprintf("%q", imp)
+	if name != base {
+		spec = name + " " + spec
+	}
+
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", file, parser.ImportsOnly)
+	if f == nil || f.Name == nil {
+		return text_edit{Offset: 0, Text: "import " + spec + "\n"}
+	}
+	offset := func(p token.Pos) int {
+		return fset.Position(p).Offset
+	}
+
+	// add to the last import declaration
+	for i := len(f.Decls) - 1; i >= 0; i-- {
+		d, ok := f.Decls[i].(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		if d.Rparen.IsValid() {
+			text := "\t" + spec + "\n"
+			// import ("fmt")
+			if n := len(d.Specs); n == 0 || fset.Position(d.Specs[n-1].End()).Line == fset.Position(d.Rparen).Line {
+				text = "\n" + text
+			}
+			return text_edit{Offset: offset(d.Rparen), Text: text}
+		}
+		end := offset(d.End())
+		return text_edit{Offset: end, Text: "\nimport " + spec}
+	}
+
+	// or right after the package clause
+	end := offset(f.Name.End())
+	if i := bytes.IndexByte(file[end:], '\n'); i != -1 {
+		end += i
+	} else {
+		end = len(file)
+	}
+	return text_edit{Offset: end, Text: "\n\nimport " + spec}
+}
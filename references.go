@@ -0,0 +1,572 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+//-------------------------------------------------------------------------
+// references
+//
+// Uses of the identifier under the cursor within the current package, see
+// "gocode references".
+//-------------------------------------------------------------------------
+
+// An identifier and what it refers to.
+type ident_ref struct {
+	name string
+	pos  token.Position // where the identifier is
+
+	// the declaration the identifier refers to and its position, the
+	// declaration is nil if the identifier declares something itself (its
+	// position is the one of the identifier then) or if it's unknown
+	decl    *decl
+	declpos token.Position
+}
+
+// Returns true if both identifiers refer to the same declaration.
+func (r *ident_ref) same_decl(other *ident_ref) bool {
+	if r.name != other.name {
+		return false
+	}
+	if r.declpos.IsValid() {
+		return r.declpos == other.declpos
+	}
+	// e.g. built-ins, they have no position
+	return r.decl != nil && r.decl == other.decl
+}
+
+// Returns the positions of the identifiers which refer to the same
+// declaration as the one under the cursor does, the declaration itself is
+// among them if it's in the current package. The current file and the other
+// files of the package are searched. Examples (# - the cursor):
+//
+//	x#.Field     // x and its declaration, other variables named x don't count
+//	t.Fie#ld     // the field of the type of t, not the Field of other types
+func (c *auto_complete_context) references(file []byte, filename string, cursor int) ([]token.Position, error) {
+	end := ident_end(file, cursor)
+	if end == -1 {
+		return nil, fmt.Errorf("no identifier under the cursor")
+	}
+	c.update_current(file, filename, cursor)
+
+	refs := c.file_refs(filename, file, c.current.filescope, c.current.decls)
+	var target *ident_ref
+	for i := range refs {
+		if r := &refs[i]; r.pos.Offset+len(r.name) == end {
+			target = r
+			break
+		}
+	}
+	if target == nil {
+		iter := new_token_iterator(file, end)
+		return nil, fmt.Errorf("not a reference: %s", iter.token().literal())
+	}
+	if !target.declpos.IsValid() && target.decl == nil {
+		return nil, fmt.Errorf("declaration not found: %s", target.name)
+	}
+
+	for _, other := range c.others {
+		data, err := file_reader.read_file(other.name)
+		if err != nil {
+			continue
+		}
+		data, _ = filter_out_shebang(data)
+		refs = append(refs, c.file_refs(other.name, data, other.filescope, other.decls)...)
+	}
+
+	var positions []token.Position
+	for i := range refs {
+		if refs[i].same_decl(target) {
+			positions = append(positions, refs[i].pos)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Filename != positions[j].Filename {
+			return positions[i].Filename < positions[j].Filename
+		}
+		return positions[i].Offset < positions[j].Offset
+	})
+	return positions, nil
+}
+
+// Parses the file and resolves all of its identifiers, 'filescope' and
+// 'decls' are the ones the file has in the caches.
+func (c *auto_complete_context) file_refs(filename string, data []byte, filescope *scope, decls map[string]*decl) []ident_ref {
+	f := new_auto_complete_file(filename, c.current.context)
+	file, _ := parser.ParseFile(f.fset, filename, data, 0)
+	if file == nil {
+		return nil
+	}
+	// the caches know the top-level declarations and the imports, the
+	// local ones are made anew, positions are resolved for this parse
+	f.filescope = new_scope(filescope)
+	f.filescope.position = f.fset.Position
+	f.scope = f.filescope
+	f.decls = decls
+	for _, d := range file.Decls {
+		anonymify_ast(d, 0, f.filescope)
+	}
+
+	w := ref_walker{auto_complete_file: f}
+	for _, d := range file.Decls {
+		w.walk_decl(d)
+	}
+	return w.refs
+}
+
+//-------------------------------------------------------------------------
+// ref_walker
+//
+// Resolves identifiers of a file. Local declarations make the same scope
+// chain auto_complete_file.process_stmt makes, but all function bodies are
+// walked from the beginning to the end, not only the blocks the cursor is in.
+//-------------------------------------------------------------------------
+
+type ref_walker struct {
+	*auto_complete_file
+	block *scope // the outermost scope of the innermost block
+	refs  []ident_ref
+}
+
+// The identifier declares something.
+func (w *ref_walker) declares(id *ast.Ident) {
+	if id.Name == "_" {
+		return
+	}
+	pos := w.fset.Position(id.Pos())
+	w.refs = append(w.refs, ident_ref{name: id.Name, pos: pos, declpos: pos})
+}
+
+// The identifier refers to 'd', which is nil if it's unknown.
+func (w *ref_walker) refers(id *ast.Ident, d *decl) {
+	if id.Name == "_" {
+		return
+	}
+	r := ident_ref{name: id.Name, pos: w.fset.Position(id.Pos()), decl: d}
+	if d != nil {
+		r.declpos = d.pos
+	}
+	w.refs = append(w.refs, r)
+}
+
+func (w *ref_walker) walk_decl(decl ast.Decl) {
+	switch t := decl.(type) {
+	case *ast.GenDecl:
+		if t.Tok == token.IMPORT {
+			return
+		}
+		for _, spec := range t.Specs {
+			w.walk_spec(spec)
+		}
+	case *ast.FuncDecl:
+		w.declares(t.Name)
+		s := w.scope
+		w.process_type_params(t)
+		if t.Recv != nil && len(t.Recv.List) != 0 {
+			// receiver type parameters are declared by the receiver
+			for _, arg := range type_args(t.Recv.List[0].Type) {
+				if id, ok := arg.(*ast.Ident); ok {
+					w.declares(id)
+				}
+			}
+		}
+		w.walk_func(t.Recv, t.Type, t.Body)
+		w.scope = s
+	}
+}
+
+// Top-level specs and the ones of local declaration statements, the names of
+// the latter are added to the scope by the caller.
+func (w *ref_walker) walk_spec(spec ast.Spec) {
+	switch t := spec.(type) {
+	case *ast.ValueSpec:
+		for _, name := range t.Names {
+			w.declares(name)
+		}
+		w.walk(t.Type)
+		for _, v := range t.Values {
+			w.walk(v)
+		}
+	case *ast.TypeSpec:
+		w.declares(t.Name)
+		s := w.scope
+		if t.TypeParams != nil {
+			w.scope = new_scope(s)
+			w.declare_type_params(t.TypeParams)
+		}
+		w.walk(t.Type)
+		w.scope = s
+	}
+}
+
+// Type parameters of a generic type, each one is a type with its constraint
+// as the underlying type.
+func (w *ref_walker) declare_type_params(tparams *ast.FieldList) {
+	s := w.scope
+	for _, field := range tparams.List {
+		w.walk(field.Type)
+		for _, name := range field.Names {
+			w.declares(name)
+			d := new_decl_full(name.Name, decl_type, 0, field.Type, nil, -1, s)
+			if d != nil {
+				d.set_pos(name.Pos())
+				w.scope.add_named_decl(d)
+			}
+		}
+	}
+}
+
+// Walks a function declaration or a function literal, type parameters (if
+// any) are in the scope already.
+func (w *ref_walker) walk_func(recv *ast.FieldList, ft *ast.FuncType, body *ast.BlockStmt) {
+	if ft.TypeParams != nil {
+		for _, field := range ft.TypeParams.List {
+			for _, name := range field.Names {
+				w.declares(name)
+			}
+			w.walk(field.Type)
+		}
+	}
+	for _, fields := range []*ast.FieldList{recv, ft.Params, ft.Results} {
+		if fields == nil {
+			continue
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				w.declares(name)
+			}
+			if fields == recv {
+				w.walk_recv_type(field.Type)
+			} else {
+				w.walk(field.Type)
+			}
+		}
+	}
+	if body == nil {
+		return
+	}
+
+	// parameters are in the same block as the body
+	labels := w.labels
+	s, block := w.enter()
+	w.process_field_list(recv, s)
+	w.process_field_list(ft.Params, s)
+	w.process_field_list(ft.Results, s)
+	w.process_labels(body)
+	for _, stmt := range body.List {
+		w.walk_stmt(stmt)
+	}
+	w.scope, w.block, w.labels = s, block, labels
+}
+
+// Type arguments of a receiver type declare type parameters, "func (l
+// *List[T])", the rest is walked as usual.
+func (w *ref_walker) walk_recv_type(t ast.Expr) {
+	if se, ok := t.(*ast.StarExpr); ok {
+		t = se.X
+	}
+	switch x := t.(type) {
+	case *ast.IndexExpr:
+		w.walk(x.X)
+		if _, ok := x.Index.(*ast.Ident); !ok {
+			w.walk(x.Index)
+		}
+	case *ast.IndexListExpr:
+		w.walk(x.X)
+		for _, index := range x.Indices {
+			if _, ok := index.(*ast.Ident); !ok {
+				w.walk(index)
+			}
+		}
+	default:
+		w.walk(t)
+	}
+}
+
+// Opens a new block (explicit or implicit one, e.g. of an "if" statement),
+// returns the scope and the block to restore when it ends.
+func (w *ref_walker) enter() (*scope, *scope) {
+	s, block := w.scope, w.block
+	w.scope = new_scope(s)
+	w.block = w.scope
+	return s, block
+}
+
+func (w *ref_walker) walk_block(list []ast.Stmt) {
+	s, block := w.enter()
+	for _, stmt := range list {
+		w.walk_stmt(stmt)
+	}
+	w.scope, w.block = s, block
+}
+
+func (w *ref_walker) walk_stmt(stmt ast.Stmt) {
+	switch t := stmt.(type) {
+	case nil:
+	case *ast.DeclStmt:
+		gd, ok := t.Decl.(*ast.GenDecl)
+		if !ok {
+			break
+		}
+		if gd.Tok == token.TYPE {
+			// a type is in the scope within its own declaration
+			w.declare_decl(gd)
+			for _, spec := range gd.Specs {
+				w.walk_spec(spec)
+			}
+			break
+		}
+		for _, spec := range gd.Specs {
+			w.walk_spec(spec)
+		}
+		w.declare_decl(gd)
+	case *ast.AssignStmt:
+		for _, e := range t.Rhs {
+			w.walk(e)
+		}
+		if t.Tok != token.DEFINE {
+			for _, e := range t.Lhs {
+				w.walk(e)
+			}
+			break
+		}
+		w.walk_define(t)
+	case *ast.IfStmt:
+		s, block := w.enter()
+		w.walk_stmt(t.Init)
+		w.walk(t.Cond)
+		w.walk_block(t.Body.List)
+		w.walk_stmt(t.Else)
+		w.scope, w.block = s, block
+	case *ast.BlockStmt:
+		w.walk_block(t.List)
+	case *ast.RangeStmt:
+		w.walk(t.X)
+		s, block := w.enter()
+		if t.Tok == token.DEFINE {
+			if id, ok := t.Key.(*ast.Ident); ok {
+				w.declares(id)
+			}
+			if id, ok := t.Value.(*ast.Ident); ok {
+				w.declares(id)
+			}
+			w.declare_range_vars(t, s)
+		} else {
+			w.walk(t.Key)
+			w.walk(t.Value)
+		}
+		w.walk_block(t.Body.List)
+		w.scope, w.block = s, block
+	case *ast.ForStmt:
+		s, block := w.enter()
+		w.walk_stmt(t.Init)
+		w.walk(t.Cond)
+		w.walk_stmt(t.Post)
+		w.walk_block(t.Body.List)
+		w.scope, w.block = s, block
+	case *ast.SwitchStmt:
+		s, block := w.enter()
+		w.walk_stmt(t.Init)
+		w.walk(t.Tag)
+		for _, stmt := range t.Body.List {
+			cc := stmt.(*ast.CaseClause)
+			for _, e := range cc.List {
+				w.walk(e)
+			}
+			w.walk_block(cc.Body)
+		}
+		w.scope, w.block = s, block
+	case *ast.TypeSwitchStmt:
+		s, block := w.enter()
+		w.walk_stmt(t.Init)
+		prevscope := w.scope
+		if assign, ok := t.Assign.(*ast.AssignStmt); ok {
+			for _, e := range assign.Rhs {
+				w.walk(e)
+			}
+			for _, e := range assign.Lhs {
+				if id, ok := e.(*ast.Ident); ok {
+					w.declares(id)
+				}
+			}
+		} else {
+			w.walk_stmt(t.Assign)
+		}
+		for _, stmt := range t.Body.List {
+			cc := stmt.(*ast.CaseClause)
+			for _, e := range cc.List {
+				w.walk(e)
+			}
+			// each clause has a variable of its own
+			cs, cblock := w.enter()
+			if tv := type_switch_var(t, cc, prevscope); tv != nil {
+				w.scope.add_named_decl(tv)
+			}
+			w.walk_block(cc.Body)
+			w.scope, w.block = cs, cblock
+		}
+		w.scope, w.block = s, block
+	case *ast.SelectStmt:
+		for _, stmt := range t.Body.List {
+			cc := stmt.(*ast.CommClause)
+			s, block := w.enter()
+			if v := comm_clause_var(cc, s); v != nil {
+				assign := cc.Comm.(*ast.AssignStmt)
+				w.walk(assign.Rhs[0])
+				for _, e := range assign.Lhs {
+					if id, ok := e.(*ast.Ident); ok {
+						w.declares(id)
+					}
+				}
+				w.scope.add_named_decl(v)
+			} else {
+				w.walk_stmt(cc.Comm)
+			}
+			w.walk_block(cc.Body)
+			w.scope, w.block = s, block
+		}
+	case *ast.LabeledStmt:
+		w.declares(t.Label)
+		w.walk_stmt(t.Stmt)
+	case *ast.BranchStmt:
+		if t.Label != nil && w.labels != nil {
+			w.refers(t.Label, w.labels.lookup(t.Label.Name))
+		}
+	default:
+		w.walk(stmt)
+	}
+}
+
+// The names of a short variable declaration which are declared in the same
+// block already are assigned to, not declared.
+func (w *ref_walker) walk_define(a *ast.AssignStmt) {
+	existing := make(map[string]*decl)
+	for _, e := range a.Lhs {
+		id, ok := e.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		for s := w.scope; s != nil; s = s.parent {
+			if d, ok := s.entities[id.Name]; ok {
+				existing[id.Name] = d
+				break
+			}
+			if s == w.block {
+				break
+			}
+		}
+	}
+
+	w.declare_assign(a)
+	for _, e := range a.Lhs {
+		id, ok := e.(*ast.Ident)
+		if !ok {
+			w.walk(e)
+			continue
+		}
+		if d, ok := existing[id.Name]; ok {
+			w.scope.replace_decl(id.Name, d)
+			w.refers(id, d)
+		} else {
+			w.declares(id)
+		}
+	}
+}
+
+// Walks an expression (or a statement without a scope of its own) and
+// resolves its identifiers in the current scope.
+func (w *ref_walker) walk(node ast.Node) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch t := node.(type) {
+		case *ast.Ident:
+			d := w.scope.lookup(t.Name)
+			if strings.HasPrefix(t.Name, "$") {
+				// anonymous struct or interface type
+				if d != nil {
+					w.walk(d.typ)
+				}
+				return false
+			}
+			w.refers(t, d)
+		case *ast.SelectorExpr:
+			w.walk(t.X)
+			w.refers(t.Sel, expr_to_decl(t.X, w.scope).find_child_and_in_embedded(t.Sel.Name))
+			return false
+		case *ast.CompositeLit:
+			w.walk(t.Type)
+			w.walk_composite_lit(t, t.Type, w.scope)
+			return false
+		case *ast.FuncLit:
+			w.walk_func(nil, t.Type, t.Body)
+			return false
+		case *ast.Field:
+			// of a struct, an interface or a function type
+			for _, name := range t.Names {
+				w.declares(name)
+			}
+			w.walk(t.Type)
+			return false
+		}
+		return true
+	})
+}
+
+// Walks the elements of a composite literal of the type 't', keys of struct
+// literals are fields. Types of nested literals may be elided, they are the
+// element types then.
+func (w *ref_walker) walk_composite_lit(lit *ast.CompositeLit, t ast.Expr, s *scope) {
+	var key, elt ast.Expr
+	var fields *decl
+	if t != nil {
+		ct, cs := advance_to_type(composite_predicate, t, s)
+		switch ct := ct.(type) {
+		case *ast.StructType:
+			fields = type_to_decl(t, s)
+			if fields == nil {
+				fields = new_decl_full("", decl_type, 0, ct, nil, -1, cs)
+			}
+		case *ast.ArrayType:
+			elt = ct.Elt
+		case *ast.MapType:
+			key, elt = ct.Key, ct.Value
+		}
+		s = cs
+	}
+
+	walk_elt := func(e, t ast.Expr) {
+		if lit, ok := e.(*ast.CompositeLit); ok && lit.Type == nil {
+			if st, ok := t.(*ast.StarExpr); ok {
+				// []*T{{...}}
+				t = st.X
+			}
+			w.walk_composite_lit(lit, t, s)
+			return
+		}
+		w.walk(e)
+	}
+	for _, e := range lit.Elts {
+		kv, ok := e.(*ast.KeyValueExpr)
+		if !ok {
+			walk_elt(e, elt)
+			continue
+		}
+		switch id, ok := kv.Key.(*ast.Ident); {
+		case ok && fields != nil:
+			w.refers(id, fields.find_child(id.Name))
+		case ok && key == nil && elt == nil:
+			// the type is unknown, the key may be a field
+			w.refers(id, nil)
+		default:
+			walk_elt(kv.Key, key)
+		}
+		walk_elt(kv.Value, elt)
+	}
+}
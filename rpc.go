@@ -3,6 +3,7 @@
 package main
 
 import (
+	"go/token"
 	"net/rpc"
 )
 
@@ -160,3 +161,157 @@ func client_options(cli *rpc.Client, Arg0 int) string {
 	}
 	return reply.Arg0
 }
+
+// wrapper for: server_impl
+
+type Args_impl struct {
+	Arg0             []byte
+	Arg1, Arg2, Arg3 string
+	Arg4             go_build_context
+}
+type Reply_impl struct {
+	Arg0, Arg1 string
+}
+
+func (r *RPC) RPC_impl(args *Args_impl, reply *Reply_impl) error {
+	reply.Arg0, reply.Arg1 = server_impl(args.Arg0, args.Arg1, args.Arg2, args.Arg3, args.Arg4)
+	return nil
+}
+func client_impl(cli *rpc.Client, Arg0 []byte, Arg1, Arg2, Arg3 string, Arg4 go_build_context) (stubs, e string) {
+	var args Args_impl
+	var reply Reply_impl
+	args.Arg0 = Arg0
+	args.Arg1 = Arg1
+	args.Arg2 = Arg2
+	args.Arg3 = Arg3
+	args.Arg4 = Arg4
+	err := cli.Call("RPC.RPC_impl", &args, &reply)
+	if err != nil {
+		panic(err)
+	}
+	return reply.Arg0, reply.Arg1
+}
+
+// wrapper for: server_definition
+
+type Args_definition struct {
+	Arg0 []byte
+	Arg1 string
+	Arg2 int
+	Arg3 go_build_context
+}
+type Reply_definition struct {
+	Arg0 token.Position
+	Arg1 string
+}
+
+func (r *RPC) RPC_definition(args *Args_definition, reply *Reply_definition) error {
+	reply.Arg0, reply.Arg1 = server_definition(args.Arg0, args.Arg1, args.Arg2, args.Arg3)
+	return nil
+}
+func client_definition(cli *rpc.Client, Arg0 []byte, Arg1 string, Arg2 int, Arg3 go_build_context) (pos token.Position, e string) {
+	var args Args_definition
+	var reply Reply_definition
+	args.Arg0 = Arg0
+	args.Arg1 = Arg1
+	args.Arg2 = Arg2
+	args.Arg3 = Arg3
+	err := cli.Call("RPC.RPC_definition", &args, &reply)
+	if err != nil {
+		panic(err)
+	}
+	return reply.Arg0, reply.Arg1
+}
+
+// wrapper for: server_type
+
+type Args_type struct {
+	Arg0 []byte
+	Arg1 string
+	Arg2 int
+	Arg3 go_build_context
+}
+type Reply_type struct {
+	Arg0 type_info
+	Arg1 string
+}
+
+func (r *RPC) RPC_type(args *Args_type, reply *Reply_type) error {
+	reply.Arg0, reply.Arg1 = server_type(args.Arg0, args.Arg1, args.Arg2, args.Arg3)
+	return nil
+}
+func client_type(cli *rpc.Client, Arg0 []byte, Arg1 string, Arg2 int, Arg3 go_build_context) (t type_info, e string) {
+	var args Args_type
+	var reply Reply_type
+	args.Arg0 = Arg0
+	args.Arg1 = Arg1
+	args.Arg2 = Arg2
+	args.Arg3 = Arg3
+	err := cli.Call("RPC.RPC_type", &args, &reply)
+	if err != nil {
+		panic(err)
+	}
+	return reply.Arg0, reply.Arg1
+}
+
+// wrapper for: server_signature
+
+type Args_signature struct {
+	Arg0 []byte
+	Arg1 string
+	Arg2 int
+	Arg3 go_build_context
+}
+type Reply_signature struct {
+	Arg0 []signature
+	Arg1 string
+}
+
+func (r *RPC) RPC_signature(args *Args_signature, reply *Reply_signature) error {
+	reply.Arg0, reply.Arg1 = server_signature(args.Arg0, args.Arg1, args.Arg2, args.Arg3)
+	return nil
+}
+func client_signature(cli *rpc.Client, Arg0 []byte, Arg1 string, Arg2 int, Arg3 go_build_context) (s []signature, e string) {
+	var args Args_signature
+	var reply Reply_signature
+	args.Arg0 = Arg0
+	args.Arg1 = Arg1
+	args.Arg2 = Arg2
+	args.Arg3 = Arg3
+	err := cli.Call("RPC.RPC_signature", &args, &reply)
+	if err != nil {
+		panic(err)
+	}
+	return reply.Arg0, reply.Arg1
+}
+
+// wrapper for: server_references
+
+type Args_references struct {
+	Arg0 []byte
+	Arg1 string
+	Arg2 int
+	Arg3 go_build_context
+}
+type Reply_references struct {
+	Arg0 []token.Position
+	Arg1 string
+}
+
+func (r *RPC) RPC_references(args *Args_references, reply *Reply_references) error {
+	reply.Arg0, reply.Arg1 = server_references(args.Arg0, args.Arg1, args.Arg2, args.Arg3)
+	return nil
+}
+func client_references(cli *rpc.Client, Arg0 []byte, Arg1 string, Arg2 int, Arg3 go_build_context) (refs []token.Position, e string) {
+	var args Args_references
+	var reply Reply_references
+	args.Arg0 = Arg0
+	args.Arg1 = Arg1
+	args.Arg2 = Arg2
+	args.Arg3 = Arg3
+	err := cli.Call("RPC.RPC_references", &args, &reply)
+	if err != nil {
+		panic(err)
+	}
+	return reply.Arg0, reply.Arg1
+}
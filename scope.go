@@ -1,5 +1,9 @@
 package main
 
+import (
+	"go/token"
+)
+
 //-------------------------------------------------------------------------
 // scope
 //-------------------------------------------------------------------------
@@ -9,6 +13,10 @@ type scope struct {
 	pkgname  string
 	parent   *scope // nil for universe scope
 	entities map[string]*decl
+
+	// maps positions of the declarations made in this scope (and its
+	// children) to file positions, nil if the parent scope knows it
+	position func(token.Pos) token.Position
 }
 
 func new_named_scope(outer *scope, name string) *scope {
@@ -64,6 +72,20 @@ func (s *scope) merge_decl(d *decl) {
 	}
 }
 
+// Resolves the position of a declaration made in this scope, the result is
+// the zero position if it's unknown.
+func (s *scope) position_of(p token.Pos) token.Position {
+	if !p.IsValid() {
+		return token.Position{}
+	}
+	for ; s != nil; s = s.parent {
+		if s.position != nil {
+			return s.position(p)
+		}
+	}
+	return token.Position{}
+}
+
 func (s *scope) lookup(name string) *decl {
 	decl, ok := s.entities[name]
 	if !ok {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"go/build"
+	"go/token"
 	"log"
 	"net"
 	"net/rpc"
@@ -57,6 +58,7 @@ type daemon struct {
 	autocomplete *auto_complete_context
 	pkgcache     package_cache
 	declcache    *decl_cache
+	pkgindex     *package_index
 	context      package_lookup_context
 }
 
@@ -73,6 +75,7 @@ func new_daemon(network, address string) *daemon {
 	d.pkgcache = new_package_cache()
 	d.declcache = new_decl_cache(&d.context)
 	d.autocomplete = new_auto_complete_context(d.pkgcache, d.declcache)
+	d.pkgindex = new_package_index()
 	return d
 }
 
@@ -80,6 +83,75 @@ func (this *daemon) drop_cache() {
 	this.pkgcache = new_package_cache()
 	this.declcache = new_decl_cache(&this.context)
 	this.autocomplete = new_auto_complete_context(this.pkgcache, this.declcache)
+	this.pkgindex = new_package_index()
+}
+
+// Updates the package lookup context for a request about 'filename', drops
+// the cache if the build context has changed.
+func (this *daemon) update_context(filename string, context package_lookup_context) {
+	// TODO: Probably we don't care about comparing all the fields, checking GOROOT and GOPATH
+	// should be enough.
+	if !reflect.DeepEqual(this.context.Context, context.Context) ||
+		this.context.GOMODCACHE != context.GOMODCACHE ||
+		this.context.GOFLAGS != context.GOFLAGS ||
+		this.context.GOWORK != context.GOWORK {
+		this.context = context
+		this.drop_cache()
+	}
+	switch g_config.PackageLookupMode {
+	case "bzl":
+		// when package lookup mode is bzl, we set GOPATH to "" explicitly and
+		// BzlProjectRoot becomes valid (or empty)
+		var err error
+		this.context.GOPATH = ""
+		this.context.BzlProjectRoot, err = find_bzl_project_root(g_config.LibPath, filename)
+		if *g_debug && err != nil {
+			log.Printf("Bzl project root not found: %s", err)
+		}
+	case "gb":
+		// when package lookup mode is gb, we set GOPATH to "" explicitly and
+		// GBProjectRoot becomes valid (or empty)
+		var err error
+		this.context.GOPATH = ""
+		this.context.GBProjectRoot, err = find_gb_project_root(filename)
+		if *g_debug && err != nil {
+			log.Printf("Gb project root not found: %s", err)
+		}
+	case "go":
+		// get current package path for GO15VENDOREXPERIMENT hack
+		this.context.CurrentPackagePath = ""
+		pkg, err := this.context.ImportDir(filepath.Dir(filename), build.FindOnly)
+		if err == nil {
+			if *g_debug {
+				log.Printf("Go project path: %s", pkg.ImportPath)
+			}
+			this.context.CurrentPackagePath = pkg.ImportPath
+		} else if *g_debug {
+			log.Printf("Go project path not found: %s", err)
+		}
+	case "module":
+		// GoWorkspace and GoModule become valid (or nil), current package
+		// path is computed from the module path
+		var err error
+		this.context.GoWorkspace, err = find_go_workspace(filename,
+			this.context.GoWorkspace, this.context.GOWORK)
+		if *g_debug && err != nil {
+			log.Printf("Go workspace not found: %s", err)
+		}
+		this.context.CurrentPackagePath = ""
+		this.context.GoModule, err = find_go_module(filename,
+			this.context.GoModule, this.context.GOFLAGS)
+		if err == nil {
+			this.context.CurrentPackagePath =
+				this.context.GoModule.import_path(filepath.Dir(filename))
+			if *g_debug {
+				log.Printf("Go module path: %s", this.context.GoModule.path)
+				log.Printf("Go project path: %s", this.context.CurrentPackagePath)
+			}
+		} else if *g_debug {
+			log.Printf("Go module not found: %s", err)
+		}
+	}
 }
 
 const (
@@ -137,50 +209,16 @@ func server_auto_complete(file []byte, filename string, cursor int, context_pack
 		if err := recover(); err != nil {
 			print_backtrace(err)
 			c = []candidate{
-				{"PANIC", "PANIC", decl_invalid, "panic"},
+				{Name: "PANIC", Type: "PANIC", Class: decl_invalid, Package: "panic", Snippet: "PANIC"},
 			}
 
 			// drop cache
 			g_daemon.drop_cache()
 		}
 	}()
-	// TODO: Probably we don't care about comparing all the fields, checking GOROOT and GOPATH
-	// should be enough.
-	if !reflect.DeepEqual(g_daemon.context.Context, context.Context) {
-		g_daemon.context = context
-		g_daemon.drop_cache()
-	}
-	switch g_config.PackageLookupMode {
-	case "bzl":
-		// when package lookup mode is bzl, we set GOPATH to "" explicitly and
-		// BzlProjectRoot becomes valid (or empty)
-		var err error
-		g_daemon.context.GOPATH = ""
-		g_daemon.context.BzlProjectRoot, err = find_bzl_project_root(g_config.LibPath, filename)
-		if *g_debug && err != nil {
-			log.Printf("Bzl project root not found: %s", err)
-		}
-	case "gb":
-		// when package lookup mode is gb, we set GOPATH to "" explicitly and
-		// GBProjectRoot becomes valid (or empty)
-		var err error
-		g_daemon.context.GOPATH = ""
-		g_daemon.context.GBProjectRoot, err = find_gb_project_root(filename)
-		if *g_debug && err != nil {
-			log.Printf("Gb project root not found: %s", err)
-		}
-	case "go":
-		// get current package path for GO15VENDOREXPERIMENT hack
-		g_daemon.context.CurrentPackagePath = ""
-		pkg, err := g_daemon.context.ImportDir(filepath.Dir(filename), build.FindOnly)
-		if err == nil {
-			if *g_debug {
-				log.Printf("Go project path: %s", pkg.ImportPath)
-			}
-			g_daemon.context.CurrentPackagePath = pkg.ImportPath
-		} else if *g_debug {
-			log.Printf("Go project path not found: %s", err)
-		}
+	g_daemon.update_context(filename, context)
+	if g_config.UnimportedPackages {
+		g_daemon.pkgindex.update(g_daemon.context.index_roots())
 	}
 	if *g_debug {
 		var buf bytes.Buffer
@@ -245,3 +283,113 @@ func server_set(key, value string) string {
 func server_options(notused int) string {
 	return g_config.options()
 }
+
+func server_impl(file []byte, filename, recv, iface string, context_packed go_build_context) (stubs, e string) {
+	context := unpack_build_context(&context_packed)
+	defer func() {
+		if err := recover(); err != nil {
+			print_backtrace(err)
+			stubs, e = "", "PANIC"
+
+			// drop cache
+			g_daemon.drop_cache()
+		}
+	}()
+	g_daemon.update_context(filename, context)
+	if *g_debug {
+		log.Printf("Got impl request for '%s': %s, %s\n", filename, recv, iface)
+	}
+	stubs, err := g_daemon.autocomplete.impl(file, filename, recv, iface)
+	if err != nil {
+		return "", err.Error()
+	}
+	return stubs, ""
+}
+
+func server_definition(file []byte, filename string, cursor int, context_packed go_build_context) (pos token.Position, e string) {
+	context := unpack_build_context(&context_packed)
+	defer func() {
+		if err := recover(); err != nil {
+			print_backtrace(err)
+			pos, e = token.Position{}, "PANIC"
+
+			// drop cache
+			g_daemon.drop_cache()
+		}
+	}()
+	g_daemon.update_context(filename, context)
+	if *g_debug {
+		log.Printf("Got definition request for '%s': %d\n", filename, cursor)
+	}
+	pos, err := g_daemon.autocomplete.definition(file, filename, cursor)
+	if err != nil {
+		return token.Position{}, err.Error()
+	}
+	return pos, ""
+}
+
+func server_type(file []byte, filename string, cursor int, context_packed go_build_context) (t type_info, e string) {
+	context := unpack_build_context(&context_packed)
+	defer func() {
+		if err := recover(); err != nil {
+			print_backtrace(err)
+			t, e = type_info{}, "PANIC"
+
+			// drop cache
+			g_daemon.drop_cache()
+		}
+	}()
+	g_daemon.update_context(filename, context)
+	if *g_debug {
+		log.Printf("Got type request for '%s': %d\n", filename, cursor)
+	}
+	t, err := g_daemon.autocomplete.cursor_type(file, filename, cursor)
+	if err != nil {
+		return type_info{}, err.Error()
+	}
+	return t, ""
+}
+
+func server_signature(file []byte, filename string, cursor int, context_packed go_build_context) (s []signature, e string) {
+	context := unpack_build_context(&context_packed)
+	defer func() {
+		if err := recover(); err != nil {
+			print_backtrace(err)
+			s, e = nil, "PANIC"
+
+			// drop cache
+			g_daemon.drop_cache()
+		}
+	}()
+	g_daemon.update_context(filename, context)
+	if *g_debug {
+		log.Printf("Got signature request for '%s': %d\n", filename, cursor)
+	}
+	s, err := g_daemon.autocomplete.signature_help(file, filename, cursor)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return s, ""
+}
+
+func server_references(file []byte, filename string, cursor int, context_packed go_build_context) (refs []token.Position, e string) {
+	context := unpack_build_context(&context_packed)
+	defer func() {
+		if err := recover(); err != nil {
+			print_backtrace(err)
+			refs, e = nil, "PANIC"
+
+			// drop cache
+			g_daemon.drop_cache()
+		}
+	}()
+	g_daemon.update_context(filename, context)
+	if *g_debug {
+		log.Printf("Got references request for '%s': %d\n", filename, cursor)
+	}
+	refs, err := g_daemon.autocomplete.references(file, filename, cursor)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return refs, ""
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+//-------------------------------------------------------------------------
+// signature
+//
+// Signature help for the call the cursor is within, see "gocode signature".
+//-------------------------------------------------------------------------
+
+type signature struct {
+	Name     string
+	Type     string
+	Params   []string // "name type" of each parameter, variadic one is "...type"
+	Param    int      // index of the active parameter, -1 if there is none
+	Package  string   // import path of the declaring package
+	Doc      string   // doc comment, see "doc-comments" config option
+	Promoted string   // embedded type the method is promoted from
+}
+
+// Returns the signatures of the function called by the call the cursor is
+// within the parentheses of. The first one is the one being called, the rest
+// are members of the same name shadowed by it, promoted from types embedded
+// deeper. Examples (# - the cursor):
+//
+//	fmt.Printf("%d", #)  // func Printf(format string, a ...any), parameter 1
+//	t.Close(#)           // T's Close and the one of the type embedded in T
+func (c *auto_complete_context) signature_help(file []byte, filename string, cursor int) ([]signature, error) {
+	c.update_current(with_cursor_filler(file, cursor), filename, cursor)
+
+	iter := new_token_iterator(file, cursor)
+	if len(iter.tokens) == 0 {
+		return nil, fmt.Errorf("the cursor is not within a call")
+	}
+	index, ok := iter.skip_to_call_lparen()
+	if !ok {
+		return nil, fmt.Errorf("the cursor is not within a call")
+	}
+	_, expr := c.deduce_cursor_decl(&iter)
+	if expr == nil || func_decl_name(iter) {
+		return nil, fmt.Errorf("the cursor is not within a call")
+	}
+	t, s, is_type := infer_type(expr, c.current.scope, -1)
+	if is_type {
+		return nil, fmt.Errorf("conversion, not a call")
+	}
+
+	b := new_out_buffers(c)
+	var sigs []signature
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		x := expr_to_decl(sel.X, c.current.scope)
+		if x != nil && x.class != decl_package {
+			sigs = c.member_signatures(x, sel.Sel.Name, index, b)
+		}
+	}
+	if len(sigs) == 0 {
+		d := c.callee_decl(expr)
+		if sig, ok := c.new_signature(d, t, s, index, b); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("unknown function")
+	}
+	return sigs, nil
+}
+
+// The iterator is at the token before the name of a function, returns true if
+// it's a function declaration: "func F(#)" or "func (r T) M(#)".
+func func_decl_name(iter token_iterator) bool {
+	if iter.token().tok == token.RPAREN {
+		if !iter.skip_to_balanced_pair() || !iter.go_back() {
+			return false
+		}
+	}
+	return iter.token().tok == token.FUNC
+}
+
+// Returns the declaration of the function a call expression calls, nil if
+// it's not a named function, e.g. a function literal or an element of a map
+// of functions.
+func (c *auto_complete_context) callee_decl(expr ast.Expr) *decl {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return c.current.scope.lookup(t.Name)
+	case *ast.SelectorExpr:
+		return expr_to_decl(t.X, c.current.scope).find_child_and_in_embedded(t.Sel.Name)
+	case *ast.IndexExpr:
+		// explicit instantiation, Map[int](#)
+		return generic_func(c.callee_decl(t.X))
+	case *ast.IndexListExpr:
+		return generic_func(c.callee_decl(t.X))
+	}
+	return nil
+}
+
+// Returns 'd' if it's a generic function, nil otherwise.
+func generic_func(d *decl) *decl {
+	if d == nil || d.class != decl_func {
+		return nil
+	}
+	if ft, ok := d.typ.(*ast.FuncType); !ok || ft.TypeParams == nil {
+		return nil
+	}
+	return d
+}
+
+// Collects the signatures of the members named 'name' of the type and of the
+// types embedded in it, level by level. The first one is the member the
+// selector resolves to.
+func (c *auto_complete_context) member_signatures(x *decl, name string, index int, b *out_buffers) []signature {
+	type level_decl struct {
+		decl *decl
+		from string // the name of the embedded type
+	}
+	var sigs []signature
+	seen := make(map[*decl]bool)
+	level := []level_decl{{decl: x}}
+	for len(level) > 0 {
+		var next []level_decl
+		for _, l := range level {
+			d := l.decl
+			if d.is_alias() {
+				if dd := d.type_dealias(); dd != nil {
+					d = dd
+				}
+			}
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+
+			if m := d.find_child(name); m != nil {
+				t, s := m.infer_type()
+				if sig, ok := c.new_signature(m, t, s, index, b); ok {
+					sig.Promoted = l.from
+					sigs = append(sigs, sig)
+				}
+			}
+			for _, emb := range d.embedded {
+				typedecl := type_to_decl(emb, d.scope)
+				if typedecl == nil {
+					continue
+				}
+				t := emb
+				if se, ok := t.(*ast.StarExpr); ok {
+					t = se.X
+				}
+				pretty_print_type_expr(b.tmpbuf, t, b.canonical_aliases)
+				next = append(next, level_decl{decl: typedecl, from: b.tmpbuf.String()})
+				b.tmpbuf.Reset()
+			}
+		}
+		level = next
+	}
+	return sigs
+}
+
+// Makes a signature of the function type 't', 'd' is the declaration of the
+// function if it's known. Returns false if 't' is not a function type.
+func (c *auto_complete_context) new_signature(d *decl, t ast.Expr, s *scope, index int, b *out_buffers) (signature, bool) {
+	var sig signature
+	if d != nil {
+		sig.Name = d.name
+		sig.Package = c.decl_package_import_path(d)
+		c.load_comments(d)
+		sig.Doc = d.doc
+	}
+
+	variadic := false
+	if id, ok := t.(*ast.Ident); ok && strings.HasPrefix(id.Name, "func(") {
+		// built-in functions have their signatures as text
+		sig.Type = id.Name
+		sig.Params = builtin_func_params(id.Name)
+		variadic = len(sig.Params) > 0 && strings.HasPrefix(sig.Params[len(sig.Params)-1], "...")
+	} else {
+		t, s = advance_to_type(func_predicate, t, s)
+		ft, ok := t.(*ast.FuncType)
+		if !ok {
+			return signature{}, false
+		}
+		ft = subst_type_params(ft, s).(*ast.FuncType)
+		pretty_print_type_expr(b.tmpbuf, ft, b.canonical_aliases)
+		sig.Type = b.tmpbuf.String()
+		b.tmpbuf.Reset()
+		sig.Params = func_params(ft, b)
+		if ft.Params.NumFields() > 0 {
+			_, variadic = ft.Params.List[len(ft.Params.List)-1].Type.(*ast.Ellipsis)
+		}
+	}
+
+	// extra arguments go to the variadic parameter
+	sig.Param = -1
+	switch n := len(sig.Params); {
+	case index < n:
+		sig.Param = index
+	case variadic:
+		sig.Param = n - 1
+	}
+	return sig, true
+}
+
+// Returns "name type" of each parameter of the function type, parameters
+// declared together ("a, b int") are split.
+func func_params(ft *ast.FuncType, b *out_buffers) []string {
+	if ft.Params == nil {
+		return nil
+	}
+	var params []string
+	for _, field := range ft.Params.List {
+		pretty_print_type_expr(b.tmpbuf, field.Type, b.canonical_aliases)
+		typ := b.tmpbuf.String()
+		b.tmpbuf.Reset()
+		if len(field.Names) == 0 {
+			params = append(params, typ)
+			continue
+		}
+		for _, name := range field.Names {
+			params = append(params, name.Name+" "+typ)
+		}
+	}
+	return params
+}
+
+// Signatures of built-in functions are not valid Go, "func(type, len[, cap])
+// type", split the parameters at the top-level commas.
+func builtin_func_params(typ string) []string {
+	typ = typ[len("func("):]
+	var params []string
+	depth, start := 0, 0
+	for i := 0; i < len(typ); i++ {
+		switch typ[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth == 0 {
+				if i > start {
+					params = append(params, typ[start:i])
+				}
+				return params
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, typ[start:i])
+				start = i + len(", ")
+			}
+		}
+	}
+	return params
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+//-------------------------------------------------------------------------
+// snippets
+//
+// Text to insert for a candidate, functions get a placeholder for each
+// parameter. See the "snippet-syntax" config option.
+//-------------------------------------------------------------------------
+
+var g_snippet_escapes = map[string]*strings.Replacer{
+	"lsp":       strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`),
+	"ultisnips": strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`, "`", "\\`"),
+}
+
+// Returns the insert text for a candidate, 'typ' is its pretty printed type.
+// E.g. "Copy(${1:dst io.Writer}, ${2:src io.Reader})" for io.Copy.
+func (b *out_buffers) snippet(name, typ string, d *decl) string {
+	if d.class != decl_func {
+		return name
+	}
+	if strings.HasPrefix(typ, "func()") {
+		return name + "()"
+	}
+	escape, ok := g_snippet_escapes[g_config.SnippetSyntax]
+	ft, isfunc := d.typ.(*ast.FuncType)
+	if !ok || !isfunc {
+		// no snippets or a built-in function
+		return name + "("
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	buf.WriteString("(")
+	n := 0
+	for _, field := range ft.Params.List {
+		ftyp := b.type_string(field.Type)
+		names := []string{""}
+		if field.Names != nil {
+			names = names[:0]
+			for _, name := range field.Names {
+				names = append(names, name.Name+" ")
+			}
+		}
+		for _, name := range names {
+			if n != 0 {
+				buf.WriteString(", ")
+			}
+			n++
+			fmt.Fprintf(&buf, "${%d:%s}", n, escape.Replace(name+ftyp))
+		}
+	}
+	buf.WriteString(")")
+	return buf.String()
+}
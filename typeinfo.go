@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//-------------------------------------------------------------------------
+// type_info
+//
+// Description of the expression under the cursor, see "gocode type".
+//-------------------------------------------------------------------------
+
+type type_info struct {
+	Name    string // identifier or the expression itself
+	Type    string
+	Class   decl_class
+	Package string // import path of the declaring package
+	Value   string // value of a constant, if it's known
+	Doc     string // doc comment of the declaration
+}
+
+// Describes the expression ending at the cursor, if the cursor is within an
+// identifier, the expression ends with the identifier. Examples (# - the
+// cursor):
+//
+//	fmt.Pri#ntln     // func(a ...any) (n int, err error)
+//	os.Args[0]#      // string
+//	time.Mi#nute     // time.Duration, 60000000000
+//	T{Fie#ld: 1}     // the type of T.Field
+//	math.Pi / 2#     // untyped float, 1.5707963267948966
+//	"abc"#           // untyped string, "abc"
+//	os.Pipe()#       // (r *os.File, w *os.File, err error)
+func (c *auto_complete_context) cursor_type(file []byte, filename string, cursor int) (type_info, error) {
+	var d *decl
+	if end := ident_end(file, cursor); end != -1 {
+		x, err := c.deduce_ident_decl(file, filename, cursor)
+		if err != nil {
+			return type_info{}, err
+		}
+		d, cursor = x, end
+	} else {
+		c.update_current(file, filename, cursor)
+	}
+
+	b := new_out_buffers(c)
+	if d != nil {
+		info := type_info{
+			Name:    d.name,
+			Class:   d.class,
+			Package: c.decl_package_import_path(d),
+		}
+		c.load_comments(d)
+		info.Doc = d.doc
+
+		v := d.eval_const()
+		if v.Kind() != constant.Unknown {
+			info.Value = const_value_string(v)
+		}
+
+		switch d.class {
+		case decl_type, decl_func:
+			d.pretty_print_type(b.tmpbuf, b.canonical_aliases)
+		case decl_var, decl_const:
+			t, s := d.infer_type()
+			if t == nil && d.class == decl_var && d.value != nil {
+				// var x = 1
+				t, s = default_literal_type([]ast.Expr{d.value}), g_universe_scope
+			}
+			if t != nil {
+				pretty_print_type_expr(b.tmpbuf, subst_type_params(t, s), b.canonical_aliases)
+			}
+		}
+		info.Type = untyped_type_name(b.tmpbuf.String())
+		if d.class == decl_const && (info.Type == "" || d.scope == g_universe_scope) {
+			info.Type = untyped_const_type(d, v)
+		}
+		return info, nil
+	}
+
+	// not an identifier, e.g. a call, a literal or a binary expression
+	expr, src := cursor_expr(file, cursor)
+	if expr == nil {
+		return type_info{}, fmt.Errorf("no expression under the cursor")
+	}
+	v := try_eval_const_expr(expr, c.current.scope)
+	if results, fs := call_results(expr, c.current.scope); results.NumFields() > 1 {
+		// a tuple of all the results, "func() " is cut off, there is no
+		// name, a tuple can't be assigned to a single variable
+		pretty_print_type_expr(b.tmpbuf, subst_type_params(&ast.FuncType{Results: results}, fs), b.canonical_aliases)
+		b.tmpbuf.Next(len("func() "))
+		return type_info{Type: b.tmpbuf.String(), Class: decl_var}, nil
+	}
+	info := type_info{Name: src, Class: decl_var}
+	t, s, is_type := infer_type(expr, c.current.scope, -1)
+	if t != nil {
+		pretty_print_type_expr(b.tmpbuf, subst_type_params(t, s), b.canonical_aliases)
+		info.Type = untyped_type_name(b.tmpbuf.String())
+	}
+	if v.Kind() != constant.Unknown {
+		info.Class = decl_const
+		info.Value = const_value_string(v)
+		if info.Type == "" {
+			// literals and untyped constants have no type expression
+			info.Type = untyped_value_type(expr, v)
+		}
+	}
+	if info.Type == "" {
+		return type_info{}, fmt.Errorf("cannot infer the type of the expression: %s", src)
+	}
+	// infer_type treats composite literals as types, T{}.Method()
+	if _, lit := expr.(*ast.CompositeLit); is_type && !lit {
+		info.Class = decl_type
+	}
+	return info, nil
+}
+
+// Returns the results of the function called by 'e' and the scope they make
+// sense in, nil if 'e' is not a function call.
+func call_results(e ast.Expr, scope *scope) (*ast.FieldList, *scope) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return nil, nil
+	}
+	t, s, is_type := infer_type(call.Fun, scope, -1)
+	if t == nil || is_type {
+		return nil, nil
+	}
+	t, s = advance_to_type(func_predicate, t, s)
+	ft, ok := t.(*ast.FuncType)
+	if !ok {
+		return nil, nil
+	}
+	if ft.TypeParams != nil {
+		ft, s = infer_func_type_args(ft, s, call.Args, scope)
+	}
+	return ft.Results, s
+}
+
+// Returns the outermost expression which ends at the cursor or, if there is
+// none, the innermost one the cursor is within, and its source. Nil if the
+// cursor is not within an expression.
+func cursor_expr(file []byte, cursor int) (ast.Expr, string) {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", file, 0)
+	if f == nil {
+		return nil, ""
+	}
+	tf := fset.File(f.Pos())
+	var ending, within ast.Expr
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil || !n.Pos().IsValid() || !n.End().IsValid() {
+			return false
+		}
+		start, end := tf.Offset(n.Pos()), tf.Offset(n.End())
+		if cursor < start || cursor > end {
+			return false
+		}
+		switch n.(type) {
+		case *ast.BadExpr, *ast.KeyValueExpr, *ast.FuncLit, *ast.FuncType:
+			// not values, or too big to be the expression under the cursor
+			return true
+		}
+		if e, ok := n.(ast.Expr); ok {
+			if end == cursor && ending == nil {
+				ending = e
+			}
+			if end != cursor {
+				within = e
+			}
+		}
+		return true
+	})
+	if ending == nil {
+		ending = within
+	}
+	if ending == nil {
+		return nil, ""
+	}
+	return ending, string(file[tf.Offset(ending.Pos()):tf.Offset(ending.End())])
+}
+
+// Returns an unknown value instead of panicking, go/constant panics on
+// invalid operations, e.g. "a" + 1 or 1 / 0.
+func try_eval_const_expr(e ast.Expr, s *scope) (v constant.Value) {
+	defer func() {
+		if err := recover(); err != nil {
+			v = constant.MakeUnknown()
+		}
+	}()
+	return eval_const_expr(e, s)
+}
+
+// Export data has special names for the types of untyped constants, e.g.
+// "&untypedInt&" is "untyped int".
+func untyped_type_name(t string) string {
+	if strings.HasPrefix(t, "&untyped") && strings.HasSuffix(t, "&") {
+		return "untyped " + strings.ToLower(t[len("&untyped"):len(t)-1])
+	}
+	return t
+}
+
+// Untyped constants declared in the source code have no type expression, the
+// kind of the value is the type.
+func untyped_const_type(d *decl, v constant.Value) string {
+	if d.scope == g_universe_scope {
+		switch d.name {
+		case "nil":
+			return "untyped nil"
+		case "iota":
+			return "untyped int"
+		}
+	}
+	return untyped_value_type(d.const_value, v)
+}
+
+// The kind of the value of an untyped constant expression is its type, rune
+// literals aside.
+func untyped_value_type(e ast.Expr, v constant.Value) string {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		e = p.X
+	}
+	if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.CHAR {
+		return "untyped rune"
+	}
+	switch v.Kind() {
+	case constant.Bool:
+		return "untyped bool"
+	case constant.String:
+		return "untyped string"
+	case constant.Int:
+		return "untyped int"
+	case constant.Float:
+		return "untyped float"
+	case constant.Complex:
+		return "untyped complex"
+	}
+	return ""
+}
+
+// Floats are rounded to float64, the exact value of a float constant is often
+// a huge fraction.
+func const_value_string(v constant.Value) string {
+	switch v.Kind() {
+	case constant.Float:
+		if f, _ := constant.Float64Val(v); !math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return v.String()
+	case constant.Complex:
+		return v.String()
+	}
+	return v.ExactString()
+}
@@ -251,6 +251,9 @@ var file_reader = new_file_reader()
 //-------------------------------------------------------------------------
 
 type go_build_context struct {
+	GOMODCACHE    string
+	GOFLAGS       string
+	GOWORK        string
 	GOARCH        string
 	GOOS          string
 	GOROOT        string
@@ -265,6 +268,10 @@ type go_build_context struct {
 
 func pack_build_context(ctx *build.Context) go_build_context {
 	return go_build_context{
+		// not a part of build.Context, but module mode needs them
+		GOMODCACHE:    os.Getenv("GOMODCACHE"),
+		GOFLAGS:       os.Getenv("GOFLAGS"),
+		GOWORK:        os.Getenv("GOWORK"),
 		GOARCH:        ctx.GOARCH,
 		GOOS:          ctx.GOOS,
 		GOROOT:        ctx.GOROOT,
@@ -292,5 +299,8 @@ func unpack_build_context(ctx *go_build_context) package_lookup_context {
 			ReleaseTags:   ctx.ReleaseTags,
 			InstallSuffix: ctx.InstallSuffix,
 		},
+		GOMODCACHE: ctx.GOMODCACHE,
+		GOFLAGS:    ctx.GOFLAGS,
+		GOWORK:     ctx.GOWORK,
 	}
 }